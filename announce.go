@@ -0,0 +1,291 @@
+package jirachat
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Largest number of resolved issues listed in an announcement
+const maxAnnouncedIssues = 20
+
+// StatusCount is the number of issues with a status
+type StatusCount struct {
+	Status string
+
+	// Key of the status category: new, indeterminate or done
+	Category string
+
+	Count int
+}
+
+// Announcement summarizes a sprint that started or closed or a version
+// that was released. Issue counts and resolved issues are only known when
+// the announcement was built with a JIRA client.
+type Announcement struct {
+	// sprint or version
+	Kind string
+
+	// e.g. Sprint 12 started, Version 1.2 released
+	Title string
+
+	// Sprint goal or version description
+	Description string
+
+	// Start and end of the sprint or release date of the version
+	StartDate string
+	EndDate   string
+
+	// Key of the project the issues belong to, when known
+	ProjectKey string
+
+	// Link to the board or release page, when known
+	URL string
+
+	// Number of issues by status, in to do, in progress, done order
+	Counts []StatusCount
+	Total  int
+
+	// Issues resolved in the closed sprint or the released version
+	Resolved []JIRAIssue
+}
+
+// NewAnnouncement builds the announcement for sprint_started,
+// sprint_closed and jira:version_released events. The issues of the sprint
+// or version are fetched when jira is set. A REST API failure is returned
+// along with the announcement built from the event alone.
+func NewAnnouncement(event *JIRAWebevent, jira *JIRAClient, domain string) (*Announcement, error) {
+	a := &Announcement{Kind: event.Kind()}
+	switch a.Kind {
+	case "sprint":
+		sprint := &event.Sprint
+		// Sprints are usually named e.g. PROJ Sprint 12
+		name := sprint.Name
+		if !strings.Contains(strings.ToLower(name), "sprint") {
+			name = "Sprint " + name
+		}
+		a.Title = fmt.Sprintf("%s %s", name, event.Action())
+		a.Description = sprint.Goal
+		a.StartDate = sprint.StartDate
+		a.EndDate = sprint.EndDate
+		if len(sprint.CompleteDate) > 0 {
+			a.EndDate = sprint.CompleteDate
+		}
+		if sprint.OriginBoardId > 0 {
+			a.URL = fmt.Sprintf("%ssecure/RapidBoard.jspa?rapidView=%d&sprint=%d",
+				siteURL(jira, domain), sprint.OriginBoardId, sprint.Id)
+		}
+	case "version":
+		version := &event.Version
+		a.Title = fmt.Sprintf("Version %s %s", version.Name, event.Action())
+		a.Description = version.Description
+		a.StartDate = version.StartDate
+		a.EndDate = version.ReleaseDate
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, event.WebhookEvent)
+	}
+
+	if jira == nil {
+		return a, nil
+	}
+	return a, a.fetch(event, jira, domain)
+}
+
+// siteURL returns the base URL of the JIRA instance of the client or,
+// without a client, of the JIRA Cloud domain
+func siteURL(jira *JIRAClient, domain string) string {
+	if jira != nil {
+		return jira.Config.siteURL()
+	}
+	return (&JIRAConfig{Domain: domain}).siteURL()
+}
+
+// fetch counts the issues of the sprint or version
+func (a *Announcement) fetch(event *JIRAWebevent, jira *JIRAClient, domain string) error {
+	var issues []JIRAIssue
+	var err error
+	if a.Kind == "sprint" {
+		issues, err = jira.SprintIssues(event.Sprint.Id)
+	} else {
+		version := &event.Version
+		issues, err = jira.SearchIssues("fixVersion = " + version.Id)
+		if err == nil && version.ProjectId > 0 {
+			var project *JIRAProject
+			project, err = jira.GetProject(strconv.Itoa(version.ProjectId))
+			if err == nil {
+				a.ProjectKey = project.Key
+				a.URL = fmt.Sprintf("%sprojects/%s/versions/%s",
+					siteURL(jira, domain), project.Key, version.Id)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]*StatusCount)
+	for _, issue := range issues {
+		status := issue.Fields.Status
+		count, ok := counts[status.Name]
+		if !ok {
+			count = &StatusCount{
+				Status:   status.Name,
+				Category: status.StatusCategory.Key,
+			}
+			counts[status.Name] = count
+		}
+		count.Count++
+		if status.StatusCategory.Key == "done" && event.Action() != "started" {
+			a.Resolved = append(a.Resolved, issue)
+		}
+		if len(a.ProjectKey) == 0 {
+			a.ProjectKey = issue.Fields.Project.Key
+		}
+	}
+	a.Total = len(issues)
+
+	for _, count := range counts {
+		a.Counts = append(a.Counts, *count)
+	}
+	order := map[string]int{"new": 0, "indeterminate": 1, "done": 2}
+	sort.Slice(a.Counts, func(i, j int) bool {
+		ci, cj := a.Counts[i], a.Counts[j]
+		if order[ci.Category] != order[cj.Category] {
+			return order[ci.Category] < order[cj.Category]
+		}
+		return ci.Status < cj.Status
+	})
+	return nil
+}
+
+// countText lists the counts, e.g. "To Do: 3, In Progress: 2, Done: 5"
+func (a *Announcement) countText() string {
+	parts := make([]string, 0, len(a.Counts))
+	for _, count := range a.Counts {
+		parts = append(parts, fmt.Sprintf("%s: %d", count.Status, count.Count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dates returns the dates of the sprint or version
+func (a *Announcement) dates() string {
+	start, end := dateOnly(a.StartDate), dateOnly(a.EndDate)
+	switch {
+	case len(start) > 0 && len(end) > 0:
+		return start + " – " + end
+	case len(end) > 0:
+		return end
+	}
+	return start
+}
+
+// dateOnly strips the time from JIRA timestamps, e.g. 2016-01-04T10:00:00.000Z
+func dateOnly(s string) string {
+	if len(s) > 10 && s[10] == 'T' {
+		return s[:10]
+	}
+	return s
+}
+
+// fields renders the announcement as Slack attachment fields
+func (a *Announcement) fields(domain string) []Field {
+	var fields []Field
+	if len(a.Description) > 0 {
+		title := "Goal"
+		if a.Kind == "version" {
+			title = "Description"
+		}
+		fields = append(fields, Field{Title: title, Value: a.Description})
+	}
+	if dates := a.dates(); len(dates) > 0 {
+		fields = append(fields, Field{Title: "Dates", Value: dates, Short: true})
+	}
+	if a.Total > 0 {
+		fields = append(fields, Field{
+			Title: fmt.Sprintf("Issues (%d)", a.Total),
+			Value: a.countText(),
+			Short: true,
+		})
+	}
+	if len(a.Resolved) > 0 {
+		lines := make([]string, 0, maxAnnouncedIssues+1)
+		for i, issue := range a.Resolved {
+			if i == maxAnnouncedIssues {
+				lines = append(lines, fmt.Sprintf("and %d more",
+					len(a.Resolved)-maxAnnouncedIssues))
+				break
+			}
+			link := fmt.Sprintf(issueLinkBase, domain, issue.Key)
+			lines = append(lines, fmt.Sprintf("• <%s|%s> %s", link, issue.Key,
+				issue.Fields.Summary))
+		}
+		fields = append(fields, Field{
+			Title: fmt.Sprintf("Resolved (%d)", len(a.Resolved)),
+			Value: strings.Join(lines, "\n"),
+		})
+	}
+	return fields
+}
+
+// HTML renders the announcement for HipChat
+func (a *Announcement) HTML(domain string) string {
+	var b strings.Builder
+	title := html.EscapeString(a.Title)
+	if len(a.URL) > 0 {
+		title = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(a.URL), title)
+	}
+	fmt.Fprintf(&b, "<b>%s</b>", title)
+	if len(a.Description) > 0 {
+		fmt.Fprintf(&b, "<br><i>%s</i>", html.EscapeString(a.Description))
+	}
+	if dates := a.dates(); len(dates) > 0 {
+		fmt.Fprintf(&b, "<br>%s", html.EscapeString(dates))
+	}
+	if a.Total > 0 {
+		fmt.Fprintf(&b, "<br>%d issues: %s", a.Total, html.EscapeString(a.countText()))
+	}
+	if len(a.Resolved) > 0 {
+		fmt.Fprintf(&b, "<br>Resolved (%d):<ul>", len(a.Resolved))
+		for i, issue := range a.Resolved {
+			if i == maxAnnouncedIssues {
+				fmt.Fprintf(&b, "<li>and %d more</li>", len(a.Resolved)-maxAnnouncedIssues)
+				break
+			}
+			fmt.Fprintf(&b, `<li><a href="%s">%s</a> %s</li>`,
+				fmt.Sprintf(issueLinkBase, domain, issue.Key),
+				html.EscapeString(issue.Key), html.EscapeString(issue.Fields.Summary))
+		}
+		b.WriteString("</ul>")
+	}
+	return b.String()
+}
+
+// announce posts the announcement for the event
+func (s *SlackService) announce(event *JIRAWebevent) error {
+	// The announcement is posted without issue counts when they can not
+	// be fetched
+	a, _ := NewAnnouncement(event, s.jira, s.Config.Domain)
+	title := "*" + a.Title + "*"
+	if len(a.URL) > 0 {
+		title = fmt.Sprintf("*<%s|%s>*", a.URL, a.Title)
+	}
+	return s.notice(event, title, "", a.fields(s.Config.Domain), false)
+}
+
+// Announce sends the announcement to the room of its project, or the
+// DefaultRoom when the project is not known
+func (r *hipService) Announce(a *Announcement) (*http.Response, error) {
+	room, err := r.ProjectRoom(a.ProjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return r.Notification(room, &NotificationRequest{
+		Message:       a.HTML(r.config_.Domain),
+		Color:         ColorPurple,
+		Notify:        true,
+		MessageFormat: FormatHTML,
+	})
+}
@@ -0,0 +1,69 @@
+package jirachat
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Issues of sprint 7, one in progress and two done
+const sprintIssues = `{"startAt":0,"maxResults":100,"total":3,"issues":[
+	{"key":"PROJ-1","fields":{"summary":"Fix it","project":{"key":"PROJ"},
+		"status":{"name":"Done","statusCategory":{"key":"done"}}}},
+	{"key":"PROJ-2","fields":{"summary":"Build it",
+		"status":{"name":"In Progress","statusCategory":{"key":"indeterminate"}}}},
+	{"key":"PROJ-3","fields":{"summary":"Ship it",
+		"status":{"name":"Done","statusCategory":{"key":"done"}}}}]}`
+
+func TestSprintAnnouncement(t *testing.T) {
+	fake, _ := newRESTServer(t, map[string]string{
+		fmt.Sprintf("/rest/agile/1.0/sprint/7/issue?validateQuery=false&fields=%s&startAt=0&maxResults=100",
+			issueListFields): sprintIssues,
+	})
+	jira, err := NewJIRAClient(httptest.NewRequest("POST", "/", nil), &JIRAConfig{
+		BaseUrl: fake.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := &JIRAWebevent{
+		WebhookEvent: EventSprintClosed,
+		Sprint: JIRASprint{
+			Id:            7,
+			Name:          "Sprint 7",
+			Goal:          "Ship it",
+			StartDate:     "2016-01-04T10:00:00.000Z",
+			EndDate:       "2016-01-18T10:00:00.000Z",
+			OriginBoardId: 2,
+		},
+	}
+	a, err := NewAnnouncement(event, jira, "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Title != "Sprint 7 closed" || a.ProjectKey != "PROJ" || a.Total != 3 {
+		t.Errorf("announcement = %+v", a)
+	}
+	if want := fake.URL + "/secure/RapidBoard.jspa?rapidView=2&sprint=7"; a.URL != want {
+		t.Errorf("URL = %q, want %q", a.URL, want)
+	}
+	if got := a.countText(); got != "In Progress: 1, Done: 2" {
+		t.Errorf("counts = %q", got)
+	}
+	if len(a.Resolved) != 2 {
+		t.Errorf("resolved = %d issues, want 2", len(a.Resolved))
+	}
+
+	html := a.HTML("example")
+	for _, want := range []string{
+		"2016-01-04 – 2016-01-18",
+		`<a href="https://example.atlassian.net/browse/PROJ-3">PROJ-3</a> Ship it`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML missing %q: %s", want, html)
+		}
+	}
+}
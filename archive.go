@@ -0,0 +1,335 @@
+package jirachat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchivedEvent is a webhook request as received from JIRA along with the
+// outcome of every attempt to deliver it
+type ArchivedEvent struct {
+	Id       string    `json:"id"`
+	Received time.Time `json:"received"`
+
+	// Request URI and headers, without credentials
+	URI     string      `json:"uri,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+
+	// The payload exactly as received, even if it isn't valid JSON
+	Body []byte `json:"body"`
+
+	Deliveries []Delivery `json:"deliveries,omitempty"`
+}
+
+// Delivery is the outcome of rendering and sending an archived event
+type Delivery struct {
+	Time time.Time `json:"time"`
+
+	// Where the event was sent, e.g. slack
+	Target string `json:"target"`
+
+	// 1 for the first delivery, higher for replays
+	Attempt int `json:"attempt"`
+
+	// Empty when the delivery succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Event parses the archived payload, see ParseBytes
+func (a *ArchivedEvent) Event() (JIRAWebevent, error) {
+	return ParseBytes(a.Body)
+}
+
+// Failed returns true if the last delivery of the event failed or it was
+// never delivered
+func (a *ArchivedEvent) Failed() bool {
+	return len(a.Deliveries) == 0 || len(a.Deliveries[len(a.Deliveries)-1].Error) > 0
+}
+
+// EventStore archives webhook requests so they can be replayed when
+// delivering them failed. Implement it on top of your datastore of choice
+// when running more than one instance.
+type EventStore interface {
+	// PutEvent saves a newly received event
+	PutEvent(event *ArchivedEvent) error
+
+	// AddDelivery records an attempt to deliver the event with the id
+	AddDelivery(id string, delivery Delivery) error
+
+	// GetEvent returns the event with the id or nil if there is none
+	GetEvent(id string) (*ArchivedEvent, error)
+
+	// Events returns the events received in [from, to) ordered by the
+	// time they were received. Zero times leave the range open.
+	Events(from, to time.Time) ([]*ArchivedEvent, error)
+}
+
+// Headers never written to an EventStore
+var secretHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// Query parameters never written to an EventStore, matched ignoring case.
+// Webhook URLs often carry a shared secret.
+var secretParams = []string{"secret", "token", "access_token", "api_key", "apikey", "password"}
+
+// scrubURI returns the request URI without the secretParams
+func scrubURI(u *url.URL) string {
+	scrubbed := *u
+	query := u.Query()
+	for name := range query {
+		for _, secret := range secretParams {
+			if strings.EqualFold(name, secret) {
+				query.Del(name)
+			}
+		}
+	}
+	scrubbed.RawQuery = query.Encode()
+	return scrubbed.RequestURI()
+}
+
+// ArchiveRequest saves the JIRA webhook request to the store before it is
+// handled. The request body is restored so it can still be Parsed.
+func ArchiveRequest(store EventStore, r *http.Request) (*ArchivedEvent, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	headers := r.Header.Clone()
+	for _, name := range secretHeaders {
+		headers.Del(name)
+	}
+	event := &ArchivedEvent{
+		Id:       newEventId(),
+		Received: time.Now().UTC(),
+		URI:      scrubURI(r.URL),
+		Headers:  headers,
+		Body:     body,
+	}
+	return event, store.PutEvent(event)
+}
+
+// newEventId returns a random id for an archived event
+func newEventId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Deliver renders the archived event with dispatch, see Replay, and
+// records the outcome in the store under the target name, e.g. slack
+func Deliver(store EventStore, event *ArchivedEvent, dispatch func(*JIRAWebevent) error, target string) error {
+	err := Replay(dispatch, event.Body)
+	delivery := Delivery{
+		Time:    time.Now().UTC(),
+		Target:  target,
+		Attempt: len(event.Deliveries) + 1,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	event.Deliveries = append(event.Deliveries, delivery)
+	if serr := store.AddDelivery(event.Id, delivery); serr != nil && err == nil {
+		return serr
+	}
+	return err
+}
+
+// inRange returns true if t is in [from, to), zero times being open ends
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// MemoryEventStore is an EventStore kept in process memory
+type MemoryEventStore struct {
+	mu     sync.Mutex
+	events map[string]*ArchivedEvent
+}
+
+// Create a new, empty, in memory EventStore
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{events: make(map[string]*ArchivedEvent)}
+}
+
+func (m *MemoryEventStore) PutEvent(event *ArchivedEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *event
+	saved.Deliveries = append([]Delivery(nil), event.Deliveries...)
+	m.events[event.Id] = &saved
+	return nil
+}
+
+func (m *MemoryEventStore) AddDelivery(id string, delivery Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event, ok := m.events[id]
+	if !ok {
+		return fmt.Errorf("No archived event %s", id)
+	}
+	event.Deliveries = append(event.Deliveries, delivery)
+	return nil
+}
+
+func (m *MemoryEventStore) GetEvent(id string) (*ArchivedEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event, ok := m.events[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *event
+	found.Deliveries = append([]Delivery(nil), event.Deliveries...)
+	return &found, nil
+}
+
+func (m *MemoryEventStore) Events(from, to time.Time) ([]*ArchivedEvent, error) {
+	m.mu.Lock()
+	var events []*ArchivedEvent
+	for _, event := range m.events {
+		if inRange(event.Received, from, to) {
+			found := *event
+			found.Deliveries = append([]Delivery(nil), event.Deliveries...)
+			events = append(events, &found)
+		}
+	}
+	m.mu.Unlock()
+	sortEvents(events)
+	return events, nil
+}
+
+func sortEvents(events []*ArchivedEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Received.Before(events[j].Received)
+	})
+}
+
+// FileEventStore is an EventStore appending events and deliveries to a
+// file as JSON, one record per line. It suits a single instance; reading
+// events scans the whole file.
+type FileEventStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// archiveRecord is a line of a FileEventStore, either a new event or a
+// delivery of an earlier one
+type archiveRecord struct {
+	Event    *ArchivedEvent `json:"event,omitempty"`
+	Id       string         `json:"id,omitempty"`
+	Delivery *Delivery      `json:"delivery,omitempty"`
+}
+
+// Create an EventStore writing to the file at path, created if missing
+func NewFileEventStore(path string) (*FileEventStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &FileEventStore{path: path}, nil
+}
+
+func (s *FileEventStore) append(record *archiveRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileEventStore) PutEvent(event *ArchivedEvent) error {
+	return s.append(&archiveRecord{Event: event})
+}
+
+func (s *FileEventStore) AddDelivery(id string, delivery Delivery) error {
+	return s.append(&archiveRecord{Id: id, Delivery: &delivery})
+}
+
+// load reads every event in the file with its deliveries, in file order
+func (s *FileEventStore) load() ([]*ArchivedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []*ArchivedEvent
+	byId := make(map[string]*ArchivedEvent)
+	dec := json.NewDecoder(f)
+	for {
+		var record archiveRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid event archive %s: %v", s.path, err)
+		}
+		switch {
+		case record.Event != nil:
+			events = append(events, record.Event)
+			byId[record.Event.Id] = record.Event
+		case record.Delivery != nil:
+			if event, ok := byId[record.Id]; ok {
+				event.Deliveries = append(event.Deliveries, *record.Delivery)
+			}
+		}
+	}
+	return events, nil
+}
+
+func (s *FileEventStore) GetEvent(id string) (*ArchivedEvent, error) {
+	events, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if event.Id == id {
+			return event, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *FileEventStore) Events(from, to time.Time) ([]*ArchivedEvent, error) {
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var events []*ArchivedEvent
+	for _, event := range all {
+		if inRange(event.Received, from, to) {
+			events = append(events, event)
+		}
+	}
+	sortEvents(events)
+	return events, nil
+}
@@ -0,0 +1,116 @@
+package jirachat
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingSlacker fails to render every event
+type failingSlacker struct {
+	recordingSlacker
+}
+
+func (f *failingSlacker) IssueUpdated(JIRAWebevent) error {
+	return errors.New("channel_not_found")
+}
+
+func TestFileEventStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	store, err := NewFileEventStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/jira?user_id=mmcfly&Token=s3cret", strings.NewReader(testPayload))
+	r.Header.Set("Authorization", "Basic c2VjcmV0")
+	r.Header.Set("X-Atlassian-Webhook-Identifier", "42")
+	archived, err := ArchiveRequest(store, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The request can still be parsed
+	event, err := Parse(r)
+	if err != nil || event.Issue.Key != "PROJ-1" {
+		t.Fatalf("parse after archiving = %s, %v", event.Issue.Key, err)
+	}
+
+	if err := Deliver(store, archived, dispatcher(&failingSlacker{}), "slack"); err == nil {
+		t.Error("failed delivery not reported")
+	}
+	if err := Deliver(store, archived, dispatcher(&recordingEventSlacker{}), "replay"); err != nil {
+		t.Error(err)
+	}
+
+	// A fresh store reads back the event with every delivery
+	store, err = NewFileEventStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := store.GetEvent(archived.Id)
+	if err != nil || found == nil {
+		t.Fatalf("get event = %v, %v", found, err)
+	}
+	if string(found.Body) != testPayload || found.URI != "/jira?user_id=mmcfly" {
+		t.Errorf("archived request = %s %s", found.URI, found.Body)
+	}
+	if found.Headers.Get("Authorization") != "" || found.Headers.Get("X-Atlassian-Webhook-Identifier") != "42" {
+		t.Errorf("archived headers = %v", found.Headers)
+	}
+	if len(found.Deliveries) != 2 || found.Deliveries[0].Error != "channel_not_found" ||
+		found.Deliveries[1].Attempt != 2 || found.Failed() {
+		t.Errorf("deliveries = %+v", found.Deliveries)
+	}
+
+	events, err := store.Events(archived.Received, time.Time{})
+	if err != nil || len(events) != 1 {
+		t.Errorf("events from received = %d, %v", len(events), err)
+	}
+	events, err = store.Events(time.Time{}, archived.Received)
+	if err != nil || len(events) != 0 {
+		t.Errorf("events before received = %d, %v", len(events), err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "c2VjcmV0") || strings.Contains(string(data), "s3cret") {
+		t.Error("credentials written to the archive")
+	}
+}
+
+func TestArchiveInvalidPayload(t *testing.T) {
+	store, err := NewFileEventStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/jira", strings.NewReader("not json"))
+	archived, err := ArchiveRequest(store, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := store.GetEvent(archived.Id)
+	if err != nil || found == nil || string(found.Body) != "not json" {
+		t.Errorf("get event = %+v, %v", found, err)
+	}
+}
+
+func TestMemoryEventStore(t *testing.T) {
+	store := NewMemoryEventStore()
+	old := &ArchivedEvent{Id: "old", Received: time.Date(2016, 1, 4, 10, 0, 0, 0, time.UTC)}
+	recent := &ArchivedEvent{Id: "new", Received: old.Received.Add(time.Hour)}
+	store.PutEvent(recent)
+	store.PutEvent(old)
+	store.AddDelivery("old", Delivery{Target: "slack", Attempt: 1})
+
+	events, _ := store.Events(time.Time{}, time.Time{})
+	if len(events) != 2 || events[0].Id != "old" || events[0].Failed() || !events[1].Failed() {
+		t.Errorf("events = %+v", events)
+	}
+	if err := store.AddDelivery("missing", Delivery{}); err == nil {
+		t.Error("delivery of a missing event accepted")
+	}
+}
@@ -0,0 +1,184 @@
+// Command jirarender renders recorded JIRA webhook payloads with the
+// default Slack and HipChat renderers and prints the messages instead of
+// sending them, so layout changes can be reviewed offline.
+//
+// Usage:
+//
+//	jirarender [-target slack|hipchat|all] [-preview] [-config render.json] payload.json...
+//
+// Payloads are read from the files or from standard input when there are
+// none. The messages are printed as JSON, or with -preview roughly as
+// Slack shows them. The optional config file sets the renderer options:
+//
+//	{"slack": {"Domain": "example", "IssueFields": ["reporter"]},
+//	 "hipchat": {"Domain": "example", "DefaultRoom": "Dev"}}
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/corytodd/jirachat"
+)
+
+// config is the renderer options read from -config
+type config struct {
+	Slack   *jirachat.SlackConfig `json:"slack"`
+	HipChat *jirachat.HipConfig   `json:"hipchat"`
+}
+
+func main() {
+	var (
+		target     = flag.String("target", "slack", "renderers to run: slack, hipchat or all")
+		preview    = flag.Bool("preview", false, "print a rough terminal preview instead of JSON")
+		configPath = flag.String("config", "", "JSON file with the slack and hipchat renderer options")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+
+	switch *target {
+	case "slack", "hipchat", "all":
+	default:
+		log.Fatalf("jirarender: unknown -target %q, use slack, hipchat or all", *target)
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	failed := false
+	for _, input := range inputs {
+		if err := render(conf, input, *target, *preview); err != nil {
+			log.Printf("%s: %v", input, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func loadConfig(path string) (*config, error) {
+	conf := &config{}
+	if len(path) > 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, conf); err != nil {
+			return nil, fmt.Errorf("Invalid config %s: %v", path, err)
+		}
+	}
+	if conf.Slack == nil {
+		conf.Slack = &jirachat.SlackConfig{}
+	}
+	if conf.HipChat == nil {
+		conf.HipChat = &jirachat.HipConfig{}
+	}
+	if len(conf.HipChat.DefaultRoom) == 0 {
+		conf.HipChat.DefaultRoom = "default"
+	}
+	return conf, nil
+}
+
+// render prints the messages rendered for the payload in the file
+func render(conf *config, input, target string, preview bool) error {
+	var payload []byte
+	var err error
+	if input == "-" {
+		payload, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		payload, err = ioutil.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+	// JIRA events can be touchy, only unreadable payloads are fatal
+	event, err := jirachat.ParseBytes(payload)
+	if len(event.WebhookEvent) == 0 {
+		return fmt.Errorf("not a JIRA webhook payload: %v", err)
+	}
+
+	var out bytes.Buffer
+	if target == "slack" || target == "all" {
+		conf.Slack.DryRun = &out
+		svc := jirachat.NewSlackService(nil, conf.Slack)
+		if err := svc.Dispatch(&event); err != nil {
+			return err
+		}
+	}
+	if target == "hipchat" || target == "all" {
+		conf.HipChat.DryRun = &out
+		svc, err := jirachat.NewHipService(nil, conf.HipChat)
+		if err != nil {
+			return err
+		}
+		if _, err := svc.Dispatch(&event); err != nil {
+			return err
+		}
+	}
+
+	if !preview {
+		_, err := out.WriteTo(os.Stdout)
+		return err
+	}
+	return printPreview(&out)
+}
+
+// printPreview prints the messages written by the dry runs as text
+func printPreview(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Target  string          `json:"target"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Printf("--- %s\n", msg.Target)
+		if strings.HasPrefix(msg.Target, "slack") {
+			var slack jirachat.SlackMessage
+			if err := json.Unmarshal(msg.Payload, &slack); err != nil {
+				return err
+			}
+			fmt.Print(slack.Preview())
+			continue
+		}
+
+		var hip jirachat.NotificationRequest
+		if err := json.Unmarshal(msg.Payload, &hip); err != nil {
+			return err
+		}
+		fmt.Printf("[%s] %s\n", hip.Color, stripTags(hip.Message))
+		if card := hip.Card; card != nil {
+			fmt.Printf("| %s\n", card.Title)
+			for _, attr := range card.Attributes {
+				fmt.Printf("| %s: %s\n", attr.Label, attr.Value.Label)
+			}
+		}
+	}
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// stripTags removes the HTML markup from HipChat messages
+func stripTags(s string) string {
+	return tags.ReplaceAllString(s, "")
+}
@@ -0,0 +1,206 @@
+// Command jirareplay resends JIRA webhook events archived by a
+// jirachat.FileEventStore to Slack, e.g. after a day of notifications was
+// lost to a misconfigured webhook.
+//
+// Usage:
+//
+//	jirareplay -store events.jsonl -from 2016-01-04 -to 2016-01-05 -failed \
+//		-webhook https://hooks.slack.com/services/... -domain example.atlassian.net
+//	jirareplay -store events.jsonl -id 1f3a9c0d2b4e5f60,7a8b9c0d1e2f3a4b -dry-run
+//	jirareplay -store events.jsonl -failed -config render.json
+//
+// Events are rendered with the default SlackService exactly as if they
+// were just received and each attempt is recorded in the store. With
+// -dry-run the events are only listed.
+//
+// The optional config file is the one jirarender reads; its slack section
+// sets the channels, fields and other options of the service, e.g.
+//
+//	{"slack": {"Token": "xoxb-...", "Channel": "#dev", "Domain": "example", "IssueFields": ["reporter"]}}
+//
+// The flags override the config file. Services rendering with their own
+// Slacker replay through jirachat.Deliver instead.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/corytodd/jirachat"
+)
+
+func main() {
+	var (
+		store   = flag.String("store", "", "event archive written by a FileEventStore")
+		from    = flag.String("from", "", "replay events received at or after this time, RFC 3339 or YYYY-MM-DD")
+		to      = flag.String("to", "", "replay events received before this time, RFC 3339 or YYYY-MM-DD")
+		ids     = flag.String("id", "", "comma separated ids of the events to replay")
+		failed  = flag.Bool("failed", false, "only replay events whose last delivery failed")
+		dryRun  = flag.Bool("dry-run", false, "list the events without sending them")
+		webhook = flag.String("webhook", "", "Slack webhook URL")
+		token   = flag.String("token", "", "Slack bot token, used instead of the webhook")
+		channel = flag.String("channel", "", "Slack channel")
+		bot     = flag.String("bot", "", "bot name reported to Slack, JIRA by default")
+		domain  = flag.String("domain", "", "JIRA domain name")
+		conf    = flag.String("config", "", "JSON file with the slack renderer options, as read by jirarender")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+
+	if len(*store) == 0 {
+		log.Fatal("jirareplay: -store is required")
+	}
+	archive, err := jirachat.NewFileEventStore(*store)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	events, err := selectEvents(archive, *ids, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var svc *jirachat.SlackService
+	if !*dryRun {
+		config, err := loadConfig(*conf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, o := range []struct{ value, field *string }{
+			{webhook, &config.WebhookUrl},
+			{token, &config.Token},
+			{channel, &config.Channel},
+			{bot, &config.BotName},
+			{domain, &config.Domain},
+		} {
+			if len(*o.value) > 0 {
+				*o.field = *o.value
+			}
+		}
+		if len(config.BotName) == 0 {
+			config.BotName = "JIRA"
+		}
+		if len(config.WebhookUrl) == 0 && len(config.Token) == 0 {
+			log.Fatal("jirareplay: -webhook, -token or -config is required unless -dry-run")
+		}
+		svc = jirachat.NewSlackService(nil, config)
+	}
+
+	replayed, failures := 0, 0
+	for _, event := range events {
+		if *failed && !event.Failed() {
+			continue
+		}
+		if *dryRun {
+			describe(event)
+			replayed++
+			continue
+		}
+		if err := jirachat.Deliver(archive, event, svc.Dispatch, "replay"); err != nil {
+			log.Printf("%s: %v", event.Id, err)
+			failures++
+			continue
+		}
+		replayed++
+	}
+
+	if *dryRun {
+		log.Printf("%d events would be replayed", replayed)
+	} else {
+		log.Printf("%d events replayed, %d failed", replayed, failures)
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadConfig reads the slack section of a jirarender config file, an empty
+// config if path is empty
+func loadConfig(path string) (*jirachat.SlackConfig, error) {
+	conf := struct {
+		Slack *jirachat.SlackConfig `json:"slack"`
+	}{}
+	if len(path) > 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return nil, fmt.Errorf("Invalid config %s: %v", path, err)
+		}
+	}
+	if conf.Slack == nil {
+		conf.Slack = &jirachat.SlackConfig{}
+	}
+	return conf.Slack, nil
+}
+
+// selectEvents returns the events with the ids or else those received in
+// the time range
+func selectEvents(archive jirachat.EventStore, ids, from, to string) ([]*jirachat.ArchivedEvent, error) {
+	if len(ids) > 0 {
+		var events []*jirachat.ArchivedEvent
+		for _, id := range strings.Split(ids, ",") {
+			event, err := archive.GetEvent(strings.TrimSpace(id))
+			if err != nil {
+				return nil, err
+			}
+			if event == nil {
+				return nil, fmt.Errorf("jirareplay: no archived event %s", id)
+			}
+			events = append(events, event)
+		}
+		return events, nil
+	}
+
+	start, err := parseTime(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(to)
+	if err != nil {
+		return nil, err
+	}
+	return archive.Events(start, end)
+}
+
+// parseTime parses an RFC 3339 time or a date in UTC, the zero time if s
+// is empty
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("jirareplay: invalid time %q", s)
+	}
+	return t, nil
+}
+
+// describe prints a line about the event for -dry-run
+func describe(event *jirachat.ArchivedEvent) {
+	status := "delivered"
+	if n := len(event.Deliveries); n == 0 {
+		status = "never delivered"
+	} else if event.Failed() {
+		status = "failed: " + event.Deliveries[n-1].Error
+	}
+
+	// JIRA events can be touchy, only unreadable payloads are reported
+	parsed, err := event.Event()
+	if len(parsed.WebhookEvent) == 0 {
+		status += fmt.Sprintf(" (not a JIRA webhook payload: %v)", err)
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\t%s\n", event.Id,
+		event.Received.Format(time.RFC3339), parsed.WebhookEvent,
+		parsed.Issue.Key, status)
+}
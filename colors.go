@@ -0,0 +1,130 @@
+package jirachat
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Issue attributes a ColorScheme can choose colors by
+const (
+	ColorByPriority       = "priority"
+	ColorByIssueType      = "issuetype"
+	ColorByStatusCategory = "statuscategory"
+	ColorByProject        = "project"
+)
+
+// ColorPair is the color of a message in each backend
+type ColorPair struct {
+	// Either good, warning, danger or any hex color code
+	Slack string
+
+	// One of the named HipChat colors, e.g. ColorRed
+	Hip string
+}
+
+// ColorScheme maps an issue attribute to message colors.
+type ColorScheme struct {
+	// Attribute the colors are chosen by, one of the ColorBy
+	// constants. Defaults to ColorByPriority.
+	By string
+
+	// Colors keyed by the id, key or name of the attribute, e.g. "1",
+	// "Blocker" or "done". Ids take precedence, names are matched
+	// regardless of case.
+	Colors map[string]ColorPair
+
+	// Color used when no entry matches
+	Default ColorPair
+}
+
+// DefaultColorScheme colors messages by the default JIRA priorities
+var DefaultColorScheme = &ColorScheme{
+	By: ColorByPriority,
+	Colors: map[string]ColorPair{
+		"1":     {"#990000", ColorRed},    // Blocker
+		"2":     {"#cc0000", ColorRed},    // Critical
+		"3":     {"#ff0000", ColorRed},    // Major
+		"6":     {"#339933", ColorGreen},  // Normal
+		"4":     {"#006600", ColorGreen},  // Minor
+		"5":     {"#003300", ColorGray},   // Trivial
+		"10000": {"#000000", ColorPurple}, // Holding
+	},
+	Default: ColorPair{ColorGood, ColorGreen},
+}
+
+// StatusCategoryColorScheme colors messages like JIRA colors status
+// lozenges: gray for to do, blue for in progress and green for done.
+var StatusCategoryColorScheme = &ColorScheme{
+	By: ColorByStatusCategory,
+	Colors: map[string]ColorPair{
+		"new":           {"#42526e", ColorGray},
+		"indeterminate": {"#0052cc", ColorYellow},
+		"done":          {"#00875a", ColorGreen},
+	},
+	Default: ColorPair{"#42526e", ColorGray},
+}
+
+// keys returns the id, key and name of the attribute colors are chosen by
+func (c *ColorScheme) keys(e *JIRAWebevent) []string {
+	f := &e.Issue.Fields
+	switch c.By {
+	case ColorByIssueType:
+		return []string{f.IssueType.Id, f.IssueType.Name}
+	case ColorByStatusCategory:
+		cat := f.Status.StatusCategory
+		return []string{strconv.Itoa(cat.Id), cat.Key, cat.Name}
+	case ColorByProject:
+		return []string{f.Project.Id, f.Project.Key, f.Project.Name}
+	}
+	return []string{f.Priority.Id, f.Priority.Name}
+}
+
+// Color returns the colors of the event's issue. Exact matches are tried
+// before case-insensitive ones, each in the order of keys. Among entries
+// differing only by case the first in sorted order wins.
+func (c *ColorScheme) Color(e *JIRAWebevent) ColorPair {
+	keys := c.keys(e)
+	for _, k := range keys {
+		if color, ok := c.Colors[k]; ok && len(k) > 0 {
+			return color
+		}
+	}
+
+	names := make([]string, 0, len(c.Colors))
+	for name := range c.Colors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, k := range keys {
+		if len(k) == 0 {
+			continue
+		}
+		for _, name := range names {
+			if strings.EqualFold(k, name) {
+				return c.Colors[name]
+			}
+		}
+	}
+	return c.Default
+}
+
+// colorScheme returns the scheme or the default one if it is nil
+func colorScheme(c *ColorScheme) *ColorScheme {
+	if c == nil {
+		return DefaultColorScheme
+	}
+	return c
+}
+
+// GetColor returns the Slack color of the event using the configured
+// color scheme
+func (e *JIRAWebevent) GetColor(s *SlackConfig) string {
+	return colorScheme(s.Colors).Color(e).Slack
+}
+
+// GetHipColor returns the HipChat color of the event using the
+// configured color scheme
+func (e *JIRAWebevent) GetHipColor(c *HipConfig) string {
+	return colorScheme(c.Colors).Color(e).Hip
+}
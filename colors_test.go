@@ -0,0 +1,72 @@
+package jirachat
+
+import "testing"
+
+func TestColorScheme(t *testing.T) {
+	red := ColorPair{"#ff0000", ColorRed}
+	green := ColorPair{"#00ff00", ColorGreen}
+	gray := ColorPair{"#cccccc", ColorGray}
+
+	tests := []struct {
+		name    string
+		scheme  *ColorScheme
+		payload string
+		want    ColorPair
+	}{
+		{"id before name",
+			&ColorScheme{Colors: map[string]ColorPair{"High": green, "2": red}, Default: gray},
+			`{"priority": {"id": "2", "name": "High"}}`, red},
+		{"exact name",
+			&ColorScheme{Colors: map[string]ColorPair{"High": green, "7": red}, Default: gray},
+			`{"priority": {"id": "2", "name": "High"}}`, green},
+		{"name regardless of case",
+			&ColorScheme{Colors: map[string]ColorPair{"high": green}, Default: gray},
+			`{"priority": {"id": "2", "name": "HIGH"}}`, green},
+		{"exact match before case-insensitive one",
+			&ColorScheme{Colors: map[string]ColorPair{"HIGH": red, "high": green}, Default: gray},
+			`{"priority": {"name": "high"}}`, green},
+		{"case-insensitive id before name",
+			&ColorScheme{By: ColorByProject, Colors: map[string]ColorPair{"proj": red, "back to the future": green}, Default: gray},
+			`{"project": {"key": "PROJ", "name": "Back to the Future"}}`, red},
+		{"first of entries differing by case",
+			&ColorScheme{Colors: map[string]ColorPair{"hIGH": red, "HigH": green}, Default: gray},
+			`{"priority": {"name": "high"}}`, green},
+		{"issue type",
+			&ColorScheme{By: ColorByIssueType, Colors: map[string]ColorPair{"bug": red}, Default: gray},
+			`{"issuetype": {"id": "1", "name": "Bug"}, "priority": {"name": "bug"}}`, red},
+		{"default",
+			&ColorScheme{Colors: map[string]ColorPair{"High": red}, Default: gray},
+			`{"priority": {"name": "Low"}}`, gray},
+		{"empty attribute",
+			&ColorScheme{Colors: map[string]ColorPair{"": red}, Default: gray},
+			`{}`, gray},
+		{"status category done", StatusCategoryColorScheme,
+			`{"status": {"name": "Closed", "statusCategory": {"id": 3, "key": "done", "name": "Done"}}}`,
+			StatusCategoryColorScheme.Colors["done"]},
+		{"status category in progress", StatusCategoryColorScheme,
+			`{"status": {"statusCategory": {"id": 4, "key": "indeterminate"}}}`,
+			StatusCategoryColorScheme.Colors["indeterminate"]},
+		{"status category unknown", StatusCategoryColorScheme,
+			`{"status": {"name": "Open"}}`, StatusCategoryColorScheme.Default},
+		{"default priorities", DefaultColorScheme,
+			`{"priority": {"id": "1", "name": "Blocker"}}`, DefaultColorScheme.Colors["1"]},
+	}
+	for _, tt := range tests {
+		event := parseString(t, `{"webhookEvent": "jira:issue_updated", "issue": {"key": "PROJ-1", "fields": `+tt.payload+`}}`)
+		// Map order varies between runs, try a few
+		for i := 0; i < 10; i++ {
+			if got := tt.scheme.Color(&event); got != tt.want {
+				t.Errorf("%s: Color = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+
+	event := parseString(t, `{"webhookEvent": "jira:issue_updated", "issue": {"fields": {"priority": {"id": "1"}}}}`)
+	if got := event.GetColor(&SlackConfig{}); got != DefaultColorScheme.Colors["1"].Slack {
+		t.Errorf("GetColor without scheme = %q", got)
+	}
+	if got := event.GetHipColor(&HipConfig{Colors: StatusCategoryColorScheme}); got != StatusCategoryColorScheme.Default.Hip {
+		t.Errorf("GetHipColor = %q", got)
+	}
+}
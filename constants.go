@@ -9,6 +9,14 @@ const (
 	ColorRandom = "random"
 	FormatText  = "text"
 	FormatHTML  = "html"
+
+	CardStyleFile        = "file"
+	CardStyleImage       = "image"
+	CardStyleApplication = "application"
+	CardStyleLink        = "link"
+	CardStyleMedia       = "media"
+	CardFormatCompact    = "compact"
+	CardFormatMedium     = "medium"
 )
 
 // Hipchat constants.
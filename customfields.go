@@ -0,0 +1,372 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of custom fields known to FieldRegistry
+const (
+	FieldString      = "string"
+	FieldNumber      = "number"
+	FieldUser        = "user"
+	FieldOption      = "option"
+	FieldMultiSelect = "multiselect"
+	FieldSprint      = "sprint"
+	FieldDate        = "date"
+	FieldEpicLink    = "epiclink"
+)
+
+// FieldInfo describes a custom field of your JIRA instance
+type FieldInfo struct {
+	// e.g. customfield_10010
+	Id string
+
+	// e.g. Story Points
+	Name string
+
+	// One of the Field type constants. Empty when unknown, in which case
+	// the type is guessed from the value.
+	Type string
+}
+
+// FieldRegistry maps custom field ids to their names and types. Fields can
+// be registered by hand, discovered from the JIRA REST API or learned from
+// payloads expanded with names.
+type FieldRegistry struct {
+	mu     sync.RWMutex
+	fields map[string]FieldInfo
+	names  map[string]string
+}
+
+// Create a new, empty, FieldRegistry
+func NewFieldRegistry() *FieldRegistry {
+	return &FieldRegistry{
+		fields: make(map[string]FieldInfo),
+		names:  make(map[string]string),
+	}
+}
+
+// DefaultFieldRegistry is used by IssueFieldData.Custom. Parse and
+// JIRAClient.GetIssue add the field names found in payloads to it.
+var DefaultFieldRegistry = NewFieldRegistry()
+
+// Register records the name and type of the custom field with the given id
+func (r *FieldRegistry) Register(id, name, fieldType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.fields[id]; ok {
+		delete(r.names, strings.ToLower(old.Name))
+	}
+	r.fields[id] = FieldInfo{Id: id, Name: name, Type: fieldType}
+	r.names[strings.ToLower(name)] = id
+}
+
+// AddNames records the names of custom fields, e.g. from the names
+// expansion of an issue. Fields already registered are left alone.
+func (r *FieldRegistry) AddNames(names map[string]string) {
+	for id, name := range names {
+		if !strings.HasPrefix(id, "customfield_") {
+			continue
+		}
+		if _, ok := r.Lookup(id); !ok {
+			r.Register(id, name, "")
+		}
+	}
+}
+
+// Lookup returns the custom field with the given id or name. Names are
+// matched regardless of case.
+func (r *FieldRegistry) Lookup(nameOrId string) (FieldInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if info, ok := r.fields[nameOrId]; ok {
+		return info, true
+	}
+	if id, ok := r.names[strings.ToLower(nameOrId)]; ok {
+		return r.fields[id], true
+	}
+	return FieldInfo{}, false
+}
+
+// jiraField is a field as returned by the JIRA field API
+type jiraField struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Custom bool   `json:"custom"`
+	Schema struct {
+		Type   string `json:"type"`
+		Items  string `json:"items"`
+		Custom string `json:"custom"`
+	} `json:"schema"`
+}
+
+// fieldType maps a field schema to one of the Field type constants
+func (f *jiraField) fieldType() string {
+	switch f.Schema.Custom {
+	case "com.pyxis.greenhopper.jira:gh-sprint":
+		return FieldSprint
+	case "com.pyxis.greenhopper.jira:gh-epic-link":
+		return FieldEpicLink
+	}
+	switch f.Schema.Type {
+	case "string", "number", "user", "date":
+		return f.Schema.Type
+	case "datetime":
+		return FieldDate
+	case "option", "option-with-child":
+		return FieldOption
+	case "array":
+		if f.Schema.Items == "option" {
+			return FieldMultiSelect
+		}
+	}
+	return ""
+}
+
+// Discover registers every custom field of the JIRA instance
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/field-getFields
+func (r *FieldRegistry) Discover(j *JIRAClient) error {
+	var fields []jiraField
+	if err := j.get("rest/api/2/field", &fields); err != nil {
+		return err
+	}
+	for i := range fields {
+		if fields[i].Custom {
+			r.Register(fields[i].Id, fields[i].Name, fields[i].fieldType())
+		}
+	}
+	return nil
+}
+
+// Field returns the custom field with the given id or name of the issue.
+// The field is empty when it is not known or not set.
+func (r *FieldRegistry) Field(f *IssueFieldData, nameOrId string) CustomField {
+	info, ok := r.Lookup(nameOrId)
+	if !ok {
+		info = FieldInfo{Id: nameOrId}
+	}
+
+	raw, ok := f.custom_[info.Id]
+	if !ok {
+		// Fields filled in by hand only have the string values
+		if v, set := f.CustomFields[info.Id]; set {
+			if json.Valid([]byte(v)) {
+				raw = json.RawMessage(v)
+			} else {
+				raw, _ = json.Marshal(v)
+			}
+		}
+	}
+	return CustomField{FieldInfo: info, Raw: raw}
+}
+
+// Custom returns the custom field with the given id or name, e.g.
+// Fields.Custom("Story Points").Float(). Names are looked up in
+// DefaultFieldRegistry.
+func (f *IssueFieldData) Custom(nameOrId string) CustomField {
+	return DefaultFieldRegistry.Field(f, nameOrId)
+}
+
+// CustomField is the value of a custom field with typed accessors. The
+// accessors return the zero value when the field is not set or does not
+// hold that type.
+type CustomField struct {
+	FieldInfo
+
+	// The field's JSON value
+	Raw json.RawMessage
+}
+
+// IsSet returns true if the field has a value
+func (c CustomField) IsSet() bool {
+	return len(c.Raw) > 0 && string(c.Raw) != "null"
+}
+
+// Float returns the value of number fields, e.g. story points
+func (c CustomField) Float() float64 {
+	var n json.Number
+	if json.Unmarshal(c.Raw, &n) != nil {
+		return 0
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// Int returns the value of number fields rounded towards zero
+func (c CustomField) Int() int {
+	return int(c.Float())
+}
+
+// User returns the value of user picker fields
+func (c CustomField) User() *JIRAUser {
+	var user JIRAUser
+	if json.Unmarshal(c.Raw, &user) != nil || len(user.Name)+len(user.AccountId) == 0 {
+		return nil
+	}
+	return &user
+}
+
+// customOption is the value of select list fields
+type customOption struct {
+	Id    string `json:"id"`
+	Value string `json:"value"`
+}
+
+// Option returns the value of single select fields
+func (c CustomField) Option() string {
+	var option customOption
+	if json.Unmarshal(c.Raw, &option) != nil {
+		return ""
+	}
+	return option.Value
+}
+
+// Options returns the values of multi select fields
+func (c CustomField) Options() []string {
+	var options []customOption
+	if json.Unmarshal(c.Raw, &options) != nil {
+		return nil
+	}
+	values := make([]string, 0, len(options))
+	for _, option := range options {
+		values = append(values, option.Value)
+	}
+	return values
+}
+
+// Sprints returns the sprints of sprint fields. Older JIRA versions send
+// sprints as strings which are parsed as well as possible.
+func (c CustomField) Sprints() []JIRASprint {
+	var sprints []JIRASprint
+	if json.Unmarshal(c.Raw, &sprints) == nil {
+		return sprints
+	}
+	var legacy []string
+	if json.Unmarshal(c.Raw, &legacy) != nil {
+		return nil
+	}
+	sprints = nil
+	for _, s := range legacy {
+		sprints = append(sprints, parseLegacySprint(s))
+	}
+	return sprints
+}
+
+// Attributes of legacy sprint strings, e.g.
+// com.atlassian.greenhopper.service.sprint.Sprint@1f39[id=1,rapidViewId=2,state=ACTIVE,name=Sprint 1,...]
+var legacySprintAttr = regexp.MustCompile(`(?:\[|,)(\w+)=`)
+
+func parseLegacySprint(s string) JIRASprint {
+	var sprint JIRASprint
+	s = strings.TrimSuffix(s, "]")
+	matches := legacySprintAttr.FindAllStringSubmatchIndex(s, -1)
+	for i, m := range matches {
+		end := len(s)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		value := s[m[1]:end]
+		if value == "<null>" {
+			continue
+		}
+		switch s[m[2]:m[3]] {
+		case "id":
+			sprint.Id, _ = strconv.Atoi(value)
+		case "rapidViewId":
+			sprint.OriginBoardId, _ = strconv.Atoi(value)
+		case "state":
+			sprint.State = strings.ToLower(value)
+		case "name":
+			sprint.Name = value
+		case "goal":
+			sprint.Goal = value
+		case "startDate":
+			sprint.StartDate = value
+		case "endDate":
+			sprint.EndDate = value
+		case "completeDate":
+			sprint.CompleteDate = value
+		}
+	}
+	return sprint
+}
+
+// Time returns the value of date and date time fields
+func (c CustomField) Time() time.Time {
+	var t JIRATime
+	if json.Unmarshal(c.Raw, &t) != nil {
+		return time.Time{}
+	}
+	return t.Time
+}
+
+// EpicLink returns the key of the epic of epic link fields
+func (c CustomField) EpicLink() string {
+	var key string
+	json.Unmarshal(c.Raw, &key)
+	return key
+}
+
+// String returns the value of the field as text, whatever its type
+func (c CustomField) String() string {
+	if !c.IsSet() {
+		return ""
+	}
+	switch c.Type {
+	case FieldOption:
+		return c.Option()
+	case FieldMultiSelect:
+		return strings.Join(c.Options(), ", ")
+	case FieldUser:
+		if user := c.User(); user != nil {
+			return user.DisplayName
+		}
+	case FieldSprint:
+		var names []string
+		for _, sprint := range c.Sprints() {
+			names = append(names, sprint.Name)
+		}
+		return strings.Join(names, ", ")
+	}
+	return rawText(c.Raw)
+}
+
+// rawText guesses the text of a JSON value: strings as is, objects by
+// their value, name or displayName and arrays joined by commas
+func rawText(raw json.RawMessage) string {
+	var v interface{}
+	if json.Unmarshal(raw, &v) != nil {
+		return ""
+	}
+	return valueText(v)
+}
+
+func valueText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}:
+		for _, k := range []string{"value", "name", "displayName"} {
+			if s, ok := v[k].(string); ok {
+				return s
+			}
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			parts = append(parts, valueText(e))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testCustomFields = `{
+	"names": {"customfield_10002": "Story Points", "customfield_10005": "Team"},
+	"fields": {
+		"summary": "Fix it",
+		"customfield_10002": 5.5,
+		"customfield_10003": {"name": "mmcfly", "displayName": "Marty McFly"},
+		"customfield_10004": [{"id": "1", "value": "iOS"}, {"id": "2", "value": "Android"}],
+		"customfield_10005": {"id": "3", "value": "Core"},
+		"customfield_10006": ["com.atlassian.greenhopper.service.sprint.Sprint@1f39[id=7,rapidViewId=2,state=ACTIVE,name=Sprint 7, the big one,goal=<null>,startDate=2016-01-04T10:00:00.000Z]"],
+		"customfield_10007": "PROJ-9",
+		"customfield_10008": "2016-01-18",
+		"customfield_10009": null
+	}
+}`
+
+func TestCustomFields(t *testing.T) {
+	var issue JIRAIssue
+	if err := json.Unmarshal([]byte(testCustomFields), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewFieldRegistry()
+	r.AddNames(issue.Names)
+	r.Register("customfield_10004", "Platforms", FieldMultiSelect)
+	r.Register("customfield_10006", "Sprint", FieldSprint)
+	f := &issue.Fields
+
+	if got := r.Field(f, "story points").Float(); got != 5.5 {
+		t.Errorf("Story Points = %v", got)
+	}
+	if user := r.Field(f, "customfield_10003").User(); user == nil || user.Name != "mmcfly" {
+		t.Errorf("user = %+v", user)
+	}
+	if got := r.Field(f, "Platforms").String(); got != "iOS, Android" {
+		t.Errorf("Platforms = %q", got)
+	}
+	if got := r.Field(f, "Team").Option(); got != "Core" {
+		t.Errorf("Team = %q", got)
+	}
+	sprints := r.Field(f, "Sprint").Sprints()
+	if len(sprints) != 1 || sprints[0].Id != 7 || sprints[0].Name != "Sprint 7, the big one" ||
+		sprints[0].State != "active" || len(sprints[0].Goal) != 0 {
+		t.Errorf("sprints = %+v", sprints)
+	}
+	if got := r.Field(f, "customfield_10007").EpicLink(); got != "PROJ-9" {
+		t.Errorf("epic link = %q", got)
+	}
+	if got := r.Field(f, "customfield_10008").Time(); got.Day() != 18 {
+		t.Errorf("date = %v", got)
+	}
+	if r.Field(f, "customfield_10009").IsSet() || r.Field(f, "Unknown").IsSet() {
+		t.Error("unset fields reported as set")
+	}
+
+	// The raw string values are kept for compatibility
+	if got := f.CustomFields["customfield_10007"]; got != "PROJ-9" {
+		t.Errorf("CustomFields = %q", got)
+	}
+}
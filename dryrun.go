@@ -0,0 +1,131 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// dryRunMessage is a message written to a DryRun writer instead of being
+// sent, e.g. {"target": "slack chat.postMessage", "payload": {...}}
+type dryRunMessage struct {
+	Target  string      `json:"target"`
+	Payload interface{} `json:"payload"`
+}
+
+// writeDryRun writes the payload meant for target as indented JSON.
+// Markup is left unescaped to keep it readable.
+func writeDryRun(w io.Writer, target string, payload interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&dryRunMessage{target, payload}); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// dryRunCounter hands out the timestamps of messages posted in dry runs,
+// so threads and updates in place still work. It is shared by the copies
+// of a SlackConfig.
+type dryRunCounter struct {
+	n int64
+}
+
+func (d *dryRunCounter) next() string {
+	return fmt.Sprintf("%d.000000", atomic.AddInt64(&d.n, 1))
+}
+
+// dryRun returns the config's counter, created for configs used without
+// a service
+func (c *SlackConfig) dryRun() *dryRunCounter {
+	slackConfigMu.Lock()
+	defer slackConfigMu.Unlock()
+	if c.dryRun_ == nil {
+		c.dryRun_ = &dryRunCounter{}
+	}
+	return c.dryRun_
+}
+
+// dryRunCall stands in for a Slack Web API call when DryRun is set.
+// Messages are written out, other methods fail as if nothing was found.
+func (c *SlackConfig) dryRunCall(method string, body interface{}) (*SlackResponse, error) {
+	if !strings.HasPrefix(method, "chat.") {
+		return nil, fmt.Errorf("Slack %s skipped in dry run", method)
+	}
+	if err := writeDryRun(c.DryRun, "slack "+method, body); err != nil {
+		return nil, err
+	}
+	channel := c.Channel
+	if msg, ok := body.(*SlackMessage); ok && len(msg.Channel) > 0 {
+		channel = msg.Channel
+	}
+	return &SlackResponse{Ok: true, Channel: channel, Ts: c.dryRun().next()}, nil
+}
+
+// dryRunDo stands in for a HipChat API request when DryRun is set
+func (c *HipConfig) dryRunDo(req *http.Request) (*http.Response, error) {
+	// Decoded again so the markup NewRequest escaped is readable
+	var payload interface{}
+	if req.Body != nil {
+		dec := json.NewDecoder(req.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	target := "hipchat " + req.Method + " " + strings.TrimPrefix(req.URL.Path, c.baseURL_.Path)
+	if err := writeDryRun(c.DryRun, target, payload); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:     "204 No Content",
+		StatusCode: http.StatusNoContent,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// Preview renders the message as plain text for a terminal, roughly the
+// way Slack lays it out. Markup is left as is.
+func (p *SlackMessage) Preview() string {
+	var b strings.Builder
+	header := strings.TrimSpace(p.Channel + "  " + p.Username)
+	if len(p.ThreadTs) > 0 {
+		header += fmt.Sprintf("  (reply to %s)", p.ThreadTs)
+	}
+	if len(header) > 0 {
+		b.WriteString(header + "\n")
+	}
+	if len(p.Text) > 0 {
+		b.WriteString(p.Text + "\n")
+	}
+	for _, a := range p.Attachments {
+		bar := "| "
+		if len(a.Color) > 0 {
+			fmt.Fprintf(&b, "%s[%s]\n", bar, a.Color)
+		}
+		for _, text := range []string{a.Pretext, a.Text} {
+			for _, line := range strings.Split(text, "\n") {
+				if len(line) > 0 {
+					b.WriteString(bar + line + "\n")
+				}
+			}
+		}
+		for _, f := range a.Fields {
+			value := strings.Replace(f.Value, "\n", "\n"+bar+"  ", -1)
+			fmt.Fprintf(&b, "%s%s: %s\n", bar, f.Title, value)
+		}
+		for _, action := range a.Actions {
+			fmt.Fprintf(&b, "%s[ %s ]\n", bar, action.Text)
+		}
+	}
+	return b.String()
+}
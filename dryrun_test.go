@@ -0,0 +1,172 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const dryRunPayload = `{
+	"webhookEvent": "jira:issue_created",
+	"user": {"name": "mmcfly", "displayName": "Marty McFly"},
+	"issue": {"id": "10001", "key": "PROJ-1", "fields": {
+		"summary": "Fix the flux capacitor",
+		"project": {"key": "PROJ"},
+		"priority": {"id": "2", "name": "High"},
+		"status": {"name": "Open"}
+	}}
+}`
+
+// dryRunTargets decodes the messages written to a DryRun writer
+func dryRunTargets(t *testing.T, out *bytes.Buffer) []dryRunMessage {
+	var msgs []dryRunMessage
+	dec := json.NewDecoder(out)
+	for {
+		var msg dryRunMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return msgs
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestSlackDryRun(t *testing.T) {
+	event := parseString(t, dryRunPayload)
+	for _, token := range []string{"", "xoxb-test"} {
+		var out bytes.Buffer
+		svc := NewSlackService(nil, &SlackConfig{
+			Channel:    "#dev",
+			Domain:     "example",
+			WebhookUrl: "http://127.0.0.1:0/unreachable",
+			ApiUrl:     "http://127.0.0.1:0/unreachable/",
+			Token:      token,
+			Threads:    NewMemoryThreadStore(),
+			DryRun:     &out,
+		})
+		if err := svc.Dispatch(&event); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "<https://example.atlassian.net/browse/PROJ-1|PROJ-1>") {
+			t.Errorf("markup escaped in %s", out.String())
+		}
+
+		msgs := dryRunTargets(t, &out)
+		want := "slack webhook"
+		if len(token) > 0 {
+			want = "slack chat.postMessage"
+		}
+		if len(msgs) != 1 || msgs[0].Target != want {
+			t.Errorf("token %q: messages = %+v", token, msgs)
+		}
+	}
+}
+
+// failingTransport fails every request and the test along with it
+type failingTransport struct {
+	t *testing.T
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.t.Errorf("request to %s in dry run", req.URL)
+	return nil, errors.New("no requests in dry runs")
+}
+
+func TestErrorNoticeDryRun(t *testing.T) {
+	var out bytes.Buffer
+	svc := NewSlackService(nil, &SlackConfig{
+		ErrChan:   "https://hooks.slack.com/services/T0/B0/ERR",
+		Transport: failingTransport{t},
+		DryRun:    &out,
+	})
+	svc.SendErrorNotice("JIRA is down", svc.Config)
+
+	msgs := dryRunTargets(t, &out)
+	if len(msgs) != 1 || msgs[0].Target != "slack error notice" {
+		t.Errorf("messages = %+v", msgs)
+	}
+}
+
+func TestDryRunTsPerConfig(t *testing.T) {
+	var out bytes.Buffer
+	config := &SlackConfig{Channel: "C1", Token: "xoxb-test", DryRun: &out}
+	created := parseString(t, threadStatusPayload)
+	comment := parseString(t, threadCommentPayload)
+
+	// Copies of the config thread replies under the ts handed out before
+	if err := NewSlackService(nil, config).IssueUpdated(&created); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSlackService(nil, config).CommentCreated(&comment); err != nil {
+		t.Fatal(err)
+	}
+	thread, _ := config.threads_.GetThread("PROJ-1")
+	if thread == nil || thread.Ts != "1.000000" {
+		t.Errorf("thread = %+v", thread)
+	}
+
+	// Other configs count on their own
+	other := &SlackConfig{Channel: "C1", Token: "xoxb-test", DryRun: &out}
+	if ts := other.dryRun().next(); ts != "1.000000" {
+		t.Errorf("ts of another config = %s", ts)
+	}
+	if ts := config.dryRun().next(); ts != "3.000000" {
+		t.Errorf("ts = %s", ts)
+	}
+}
+
+func TestHipDryRun(t *testing.T) {
+	event := parseString(t, dryRunPayload)
+	var out bytes.Buffer
+	svc, err := NewHipService(nil, &HipConfig{
+		Domain:       "example",
+		ProjectRooms: map[string]string{"PROJ": "Dev"},
+		DryRun:       &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Dispatch(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := dryRunTargets(t, &out)
+	if len(msgs) != 1 || msgs[0].Target != "hipchat POST room/Dev/notification" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	payload, _ := msgs[0].Payload.(map[string]interface{})
+	if payload["message"] != `<b>Marty McFly</b> created <a href="https://example.atlassian.net/browse/PROJ-1">PROJ-1</a>` {
+		t.Errorf("message = %v", payload["message"])
+	}
+}
+
+func TestSlackPreview(t *testing.T) {
+	msg := &SlackMessage{
+		Channel:  "#dev",
+		Username: "JIRA",
+		Attachments: []Attachment{{
+			Pretext: "Marty created PROJ-1",
+			Color:   "#cc0000",
+			Fields: []Field{
+				{Title: "Summary", Value: "Fix it"},
+				{Title: "Links", Value: "blocks PROJ-2\nblocks PROJ-3"},
+			},
+			Actions: []Action{{Text: "Assign to me"}},
+		}},
+	}
+	want := "#dev  JIRA\n" +
+		"| [#cc0000]\n" +
+		"| Marty created PROJ-1\n" +
+		"| Summary: Fix it\n" +
+		"| Links: blocks PROJ-2\n" +
+		"|   blocks PROJ-3\n" +
+		"| [ Assign to me ]\n"
+	if got := msg.Preview(); got != want {
+		t.Errorf("preview =\n%s\nwant\n%s", got, want)
+	}
+}
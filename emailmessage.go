@@ -0,0 +1,300 @@
+package jirachat
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// EmailMessage represents a multipart/alternative email with an HTML
+// and a plain text rendering of the same JIRA event.
+type EmailMessage struct {
+	From    string
+	To      []string
+	Subject string
+
+	// Plain text and HTML bodies
+	Text string
+	HTML string
+
+	// Threading headers. MessageId is always set, InReplyTo and
+	// References are set for every message after the first one about
+	// an issue.
+	MessageId  string
+	InReplyTo  string
+	References string
+}
+
+// emailField is a single titled row in the rendered email. Rich text
+// fields carry an HTML rendering used in place of Value in the HTML part.
+type emailField struct {
+	Title string
+	Value string
+	HTML  htmltemplate.HTML
+}
+
+// richField returns a field rendering JIRA markup in both parts
+func richField(title string, text JIRAText) emailField {
+	return emailField{
+		Title: title,
+		Value: text.Text(),
+		HTML:  htmltemplate.HTML(text.HTML()),
+	}
+}
+
+// emailData is the data passed to the email templates
+type emailData struct {
+	Title  string
+	Key    string
+	Link   string
+	Fields []emailField
+}
+
+var emailTextTemplate = template.Must(template.New("text").Parse(
+	`{{.Title}}
+{{range .Fields}}
+{{.Title}}:
+{{.Value}}
+{{end}}
+{{.Link}}
+`))
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(
+	`<html>
+<body>
+<p>{{.Title}}</p>
+<table>
+{{range .Fields}}<tr><th align="left" valign="top">{{.Title}}</th>{{if .HTML}}<td>{{.HTML}}</td>{{else}}<td style="white-space: pre-wrap">{{.Value}}</td>{{end}}</tr>
+{{end}}</table>
+<p><a href="{{.Link}}">View {{.Key}} in JIRA</a></p>
+</body>
+</html>
+`))
+
+// Bytes returns the message encoded as an RFC 5322 email ready to be
+// handed to an SMTP server.
+func (m *EmailMessage) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := func(k, v string) {
+		if len(v) > 0 {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+		}
+	}
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", m.MessageId)
+	header("In-Reply-To", m.InReplyTo)
+	header("References", m.References)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newMessage renders the templates and fills in the addressing and
+// threading headers. The first message about an issue (its creation)
+// becomes the thread root, all others reply to it.
+func (s *EmailService) newMessage(event *JIRAWebevent, subject, title string,
+	fields []emailField, root bool) (*EmailMessage, error) {
+
+	key := event.Issue.Key
+	data := emailData{
+		Title:  title,
+		Key:    key,
+		Link:   fmt.Sprintf(issueLinkBase, s.Config.Domain, key),
+		Fields: fields,
+	}
+
+	var text, html bytes.Buffer
+	if err := emailTextTemplate.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := emailHTMLTemplate.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	msg := &EmailMessage{
+		From:    s.Config.From,
+		To:      s.Config.To,
+		Subject: fmt.Sprintf("[%s] %s", key, subject),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}
+	thread := s.Config.threadId(key)
+	if root {
+		msg.MessageId = thread
+	} else {
+		msg.MessageId = s.Config.messageId(key)
+		msg.InReplyTo = thread
+		msg.References = thread
+	}
+	return msg, nil
+}
+
+// send renders and delivers a message in one step
+func (s *EmailService) send(event *JIRAWebevent, subject, title string,
+	fields []emailField, root bool) error {
+	msg, err := s.newMessage(event, subject, title, fields, root)
+	if err != nil {
+		return err
+	}
+	return msg.Send(s.Config)
+}
+
+// Default email for issue_created type
+func (s *EmailService) IssueCreated(event *JIRAWebevent) error {
+	fields := []emailField{
+		{Title: "Summary", Value: event.Issue.Fields.Summary},
+		{Title: "Assignee", Value: event.Issue.Fields.Assignee.DisplayName},
+		{Title: "Priority", Value: event.Issue.Fields.Priority.Name},
+		richField("Description", event.Issue.Fields.Description),
+	}
+	subject := "Created: " + event.Issue.Fields.Summary
+	title := fmt.Sprintf("%s created %s", event.User.DisplayName,
+		event.Issue.Key)
+	return s.send(event, subject, title, fields, true)
+}
+
+// Default email for issue_updated type. Comments, status and assignee
+// changes get their own subject lines, any other change lists every
+// changed field.
+func (s *EmailService) IssueUpdated(event *JIRAWebevent) error {
+	if len(event.Comment.Id) > 0 {
+		return s.CommentCreated(event)
+	}
+
+	user := event.User.DisplayName
+	var subject, title string
+	var fields []emailField
+	items := event.Changelog.Items
+	switch {
+	case len(items) > 0 && items[0].Field == "status":
+		subject = fmt.Sprintf("Status changed: %s → %s",
+			items[0].FromString, items[0].ToString)
+		title = fmt.Sprintf("%s changed status of %s", user, event.Issue.Key)
+		fields = []emailField{
+			{Title: "From", Value: items[0].FromString},
+			{Title: "To", Value: items[0].ToString},
+		}
+	case len(items) > 0 && items[0].Field == "assignee":
+		from := "unassigned"
+		if len(items[0].FromString) > 0 {
+			from = items[0].FromString
+		}
+		to := "unassigned"
+		if len(items[0].ToString) > 0 {
+			to = items[0].ToString
+		}
+		subject = fmt.Sprintf("Assignee changed: %s → %s", from, to)
+		title = fmt.Sprintf("%s changed assignee of %s", user, event.Issue.Key)
+		fields = []emailField{
+			{Title: "From", Value: from},
+			{Title: "To", Value: to},
+		}
+	default:
+		names := make([]string, 0, len(items))
+		for _, item := range items {
+			names = append(names, item.Field)
+			fields = append(fields, emailField{
+				Title: item.Field,
+				Value: fmt.Sprintf("%s → %s", item.FromString, item.ToString),
+			})
+		}
+		subject = "Updated"
+		if len(names) > 0 {
+			subject += ": " + strings.Join(names, ", ")
+		}
+		title = fmt.Sprintf("%s modified %s", user, event.Issue.Key)
+	}
+	fields = append([]emailField{
+		{Title: "Summary", Value: event.Issue.Fields.Summary},
+	}, fields...)
+	return s.send(event, subject, title, fields, false)
+}
+
+// Default email for issue_deleted type
+func (s *EmailService) IssueDeleted(event *JIRAWebevent) error {
+	fields := []emailField{
+		{Title: "Summary", Value: event.Issue.Fields.Summary},
+	}
+	subject := "Deleted: " + event.Issue.Fields.Summary
+	title := fmt.Sprintf("%s deleted %s", event.User.DisplayName,
+		event.Issue.Key)
+	return s.send(event, subject, title, fields, false)
+}
+
+// Default email for worklog_updated type
+func (s *EmailService) WorklogUpdated(event *JIRAWebevent) error {
+	sum := event.WorklogSummary()
+	f := durationFormat(s.Config.Durations)
+
+	fields := []emailField{
+		{Title: "Summary", Value: event.Issue.Fields.Summary},
+	}
+	if sum.Logged != 0 {
+		fields = append(fields, emailField{Title: "Time Spent", Value: sum.LoggedText(f)})
+	}
+	if !sum.Started.IsZero() {
+		fields = append(fields, emailField{Title: "Started", Value: sum.Started.FormatIn(sum.Author.TimeZone)})
+	}
+	if progress := sum.Progress(f); len(progress) > 0 {
+		fields = append(fields, emailField{Title: "Logged", Value: progress})
+	}
+	if remaining := sum.RemainingText(f); len(remaining) > 0 {
+		fields = append(fields, emailField{Title: "Remaining", Value: remaining})
+	}
+	if len(sum.Comment) > 0 {
+		fields = append(fields, richField("Comment", sum.Comment))
+	}
+	subject := "Work logged"
+	title := fmt.Sprintf("%s updated work log %s", sum.Author.DisplayName,
+		event.Issue.Key)
+	return s.send(event, subject, title, fields, false)
+}
+
+// Default email for comment_created type
+func (s *EmailService) CommentCreated(event *JIRAWebevent) error {
+	author := event.Comment.Author.DisplayName
+	fields := []emailField{
+		{Title: "Summary", Value: event.Issue.Fields.Summary},
+		richField("Comment", event.Comment.Body),
+	}
+	subject := "New comment by " + author
+	title := fmt.Sprintf("%s commented on %s", author, event.Issue.Key)
+	return s.send(event, subject, title, fields, false)
+}
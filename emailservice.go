@@ -0,0 +1,92 @@
+package jirachat
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Configuration used by EmailService to deliver JIRA events over SMTP.
+type EmailConfig struct {
+	// SMTP server address, e.g. smtp.example.com:587
+	Server string
+
+	// Optional SMTP credentials. When Username is empty no
+	// authentication is attempted.
+	Username string
+	Password string
+
+	// Sender address, e.g. jira@example.com
+	From string
+
+	// Recipient addresses
+	To []string
+
+	// JIRA domain name
+	Domain string
+
+	// Optional working hours per day and days per week used to format
+	// logged time. Defaults to DefaultDurationFormat.
+	Durations *DurationFormat
+}
+
+// EmailService renders JIRA events as multipart HTML/plain email
+type EmailService struct {
+	Config *EmailConfig
+}
+
+// Create a new email service with the given config. An email service
+// provides default JIRAWebEvent renderers which mail every recipient
+// in the config.
+func NewEmailService(config *EmailConfig) (*EmailService, error) {
+	if err := config.IsValid(); err != nil {
+		return nil, err
+	}
+	return &EmailService{Config: config}, nil
+}
+
+// Returns an error if the configuration is missing required values
+func (c *EmailConfig) IsValid() error {
+	switch {
+	case len(c.Server) == 0:
+		return errors.New("Invalid SMTP server")
+	case len(c.From) == 0:
+		return errors.New("Invalid email sender")
+	case len(c.To) == 0:
+		return errors.New("No email recipients")
+	}
+	return nil
+}
+
+// threadId returns the Message-ID used as the root of the mail thread for
+// an issue. Every message about the same issue references it so mail
+// clients group the updates together.
+func (c *EmailConfig) threadId(key string) string {
+	return fmt.Sprintf("<%s@%s.jirachat>", key, c.Domain)
+}
+
+// messageId returns a new unique Message-ID for an issue
+func (c *EmailConfig) messageId(key string) string {
+	return fmt.Sprintf("<%s.%d@%s.jirachat>", key, time.Now().UnixNano(),
+		c.Domain)
+}
+
+// Send delivers the message to the SMTP server in config.
+func (m *EmailMessage) Send(config *EmailConfig) error {
+	var auth smtp.Auth
+	if len(config.Username) > 0 {
+		host := config.Server
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(config.Server, auth, m.From, m.To, data)
+}
@@ -0,0 +1,178 @@
+package jirachat
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP is a minimal SMTP server accepting every message it is sent
+type fakeSMTP struct {
+	ln       net.Listener
+	messages chan []byte
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, messages: make(chan []byte, 10)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data []byte
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data = append(data, strings.TrimPrefix(l, ".")...)
+			}
+			s.messages <- data
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func testEmailService(t *testing.T) (*EmailService, *fakeSMTP) {
+	srv := newFakeSMTP(t)
+	svc, err := NewEmailService(&EmailConfig{
+		Server: srv.ln.Addr().String(),
+		From:   "jira@example.com",
+		To:     []string{"manager@example.com"},
+		Domain: "example",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, srv
+}
+
+func testEmailEvent() *JIRAWebevent {
+	event := &JIRAWebevent{}
+	event.Issue.Key = "PROJ-123"
+	event.Issue.Fields.Summary = "Fix the <frobnicator>"
+	event.User.DisplayName = "Marty McFly"
+	return event
+}
+
+func TestEmailStatusChanged(t *testing.T) {
+	svc, srv := testEmailService(t)
+	event := testEmailEvent()
+	event.Changelog.Items = []ChangleLogItems{
+		{Field: "status", FromString: "In Progress", ToString: "Done"},
+	}
+
+	if err := svc.IssueUpdated(event); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(<-srv.messages)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[PROJ-123] Status changed: In Progress → Done"; subject != want {
+		t.Errorf("Subject = %q, want %q", subject, want)
+	}
+
+	thread := "<PROJ-123@example.jirachat>"
+	if got := msg.Header.Get("In-Reply-To"); got != thread {
+		t.Errorf("In-Reply-To = %q, want %q", got, thread)
+	}
+	if got := msg.Header.Get("References"); got != thread {
+		t.Errorf("References = %q, want %q", got, thread)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(p)
+		types = append(types, p.Header.Get("Content-Type"))
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "text/html") &&
+			!strings.Contains(string(body), "&lt;frobnicator&gt;") {
+			t.Errorf("HTML part does not escape summary: %s", body)
+		}
+	}
+	if len(types) != 2 {
+		t.Errorf("got parts %v, want text and html", types)
+	}
+}
+
+func TestEmailIssueCreatedStartsThread(t *testing.T) {
+	svc, srv := testEmailService(t)
+
+	if err := svc.IssueCreated(testEmailEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(<-srv.messages)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("Message-ID"); got != "<PROJ-123@example.jirachat>" {
+		t.Errorf("Message-ID = %q", got)
+	}
+	if got := msg.Header.Get("In-Reply-To"); got != "" {
+		t.Errorf("In-Reply-To = %q, want none", got)
+	}
+}
@@ -0,0 +1,172 @@
+package jirachat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Names of the JIRA webhook events, as found in JIRAWebevent.WebhookEvent
+//
+// https://developer.atlassian.com/server/jira/platform/webhooks/
+const (
+	EventIssueCreated = "jira:issue_created"
+	EventIssueUpdated = "jira:issue_updated"
+	EventIssueDeleted = "jira:issue_deleted"
+
+	// Sent by older JIRA versions with the time spent in the changelog
+	EventLegacyWorklogUpdated = "jira:worklog_updated"
+
+	EventCommentCreated = "comment_created"
+	EventCommentUpdated = "comment_updated"
+	EventCommentDeleted = "comment_deleted"
+
+	EventWorklogCreated = "worklog_created"
+	EventWorklogUpdated = "worklog_updated"
+	EventWorklogDeleted = "worklog_deleted"
+
+	EventIssueLinkCreated = "issuelink_created"
+	EventIssueLinkDeleted = "issuelink_deleted"
+
+	EventSprintCreated = "sprint_created"
+	EventSprintUpdated = "sprint_updated"
+	EventSprintStarted = "sprint_started"
+	EventSprintClosed  = "sprint_closed"
+	EventSprintDeleted = "sprint_deleted"
+
+	EventVersionCreated    = "jira:version_created"
+	EventVersionUpdated    = "jira:version_updated"
+	EventVersionReleased   = "jira:version_released"
+	EventVersionUnreleased = "jira:version_unreleased"
+	EventVersionMoved      = "jira:version_moved"
+	EventVersionDeleted    = "jira:version_deleted"
+
+	EventProjectCreated = "project_created"
+	EventProjectUpdated = "project_updated"
+	EventProjectDeleted = "project_deleted"
+
+	EventUserCreated = "user_created"
+	EventUserUpdated = "user_updated"
+	EventUserDeleted = "user_deleted"
+
+	EventBoardCreated              = "board_created"
+	EventBoardUpdated              = "board_updated"
+	EventBoardDeleted              = "board_deleted"
+	EventBoardConfigurationChanged = "board_configuration_changed"
+
+	EventAttachmentCreated = "attachment_created"
+	EventAttachmentDeleted = "attachment_deleted"
+)
+
+var ErrUnknownEvent = errors.New("unknown JIRA webhook event")
+
+// EventSlacker is implemented by Slackers that also render the events
+// beyond issues, new comments and the legacy work log event. Each method
+// handles every action of its kind of event, see Action.
+type EventSlacker interface {
+	CommentChanged(*JIRAWebevent) error
+	WorklogChanged(*JIRAWebevent) error
+	IssueLinkChanged(*JIRAWebevent) error
+	SprintChanged(*JIRAWebevent) error
+	VersionChanged(*JIRAWebevent) error
+	ProjectChanged(*JIRAWebevent) error
+	UserChanged(*JIRAWebevent) error
+	BoardChanged(*JIRAWebevent) error
+	AttachmentChanged(*JIRAWebevent) error
+}
+
+// Kind returns the kind of object the event is about, e.g. "version" for
+// jira:version_released
+func (e *JIRAWebevent) Kind() string {
+	name := strings.TrimPrefix(e.WebhookEvent, "jira:")
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// Action returns what happened to the object, e.g. "released" for
+// jira:version_released or "configuration changed" for
+// board_configuration_changed
+func (e *JIRAWebevent) Action() string {
+	name := strings.TrimPrefix(e.WebhookEvent, "jira:")
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		return strings.Replace(name[i+1:], "_", " ", -1)
+	}
+	return ""
+}
+
+// Dispatch calls the method of the Slacker rendering the event. Events
+// other than the ones in the Slacker interface require an EventSlacker,
+// others return ErrUnknownEvent.
+func Dispatch(s Slacker, event *JIRAWebevent) error {
+	return dispatch(slackerRenderer{s}, s, event)
+}
+
+// renderer renders the events of the Slacker interface, all passed by
+// pointer like SlackService takes them
+type renderer interface {
+	IssueCreated(*JIRAWebevent) error
+	IssueDeleted(*JIRAWebevent) error
+	IssueUpdated(*JIRAWebevent) error
+	WorklogUpdated(*JIRAWebevent) error
+	CommentCreated(*JIRAWebevent) error
+}
+
+// slackerRenderer adapts a Slacker to the renderer interface
+type slackerRenderer struct {
+	Slacker
+}
+
+func (r slackerRenderer) IssueDeleted(e *JIRAWebevent) error   { return r.Slacker.IssueDeleted(*e) }
+func (r slackerRenderer) IssueUpdated(e *JIRAWebevent) error   { return r.Slacker.IssueUpdated(*e) }
+func (r slackerRenderer) WorklogUpdated(e *JIRAWebevent) error { return r.Slacker.WorklogUpdated(*e) }
+func (r slackerRenderer) CommentCreated(e *JIRAWebevent) error { return r.Slacker.CommentCreated(*e) }
+
+// dispatch renders the event with r or, for the other events, with s if
+// it is an EventSlacker
+func dispatch(r renderer, s interface{}, event *JIRAWebevent) error {
+	switch event.WebhookEvent {
+	case EventIssueCreated:
+		return r.IssueCreated(event)
+	case EventIssueUpdated:
+		return r.IssueUpdated(event)
+	case EventIssueDeleted:
+		return r.IssueDeleted(event)
+	case EventLegacyWorklogUpdated:
+		return r.WorklogUpdated(event)
+	case EventCommentCreated:
+		return r.CommentCreated(event)
+	}
+
+	ext, ok := s.(EventSlacker)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, event.WebhookEvent)
+	}
+	switch event.Kind() {
+	case "comment":
+		return ext.CommentChanged(event)
+	case "worklog":
+		return ext.WorklogChanged(event)
+	case "issuelink":
+		return ext.IssueLinkChanged(event)
+	case "sprint":
+		return ext.SprintChanged(event)
+	case "version":
+		return ext.VersionChanged(event)
+	case "project":
+		return ext.ProjectChanged(event)
+	case "user":
+		return ext.UserChanged(event)
+	case "board":
+		return ext.BoardChanged(event)
+	case "attachment":
+		return ext.AttachmentChanged(event)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownEvent, event.WebhookEvent)
+}
+
+// Dispatch renders the event with the default renderer for its type
+func (s *SlackService) Dispatch(event *JIRAWebevent) error {
+	return dispatch(s, s, event)
+}
@@ -0,0 +1,132 @@
+package jirachat
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordingSlacker records the renderer called for each event
+type recordingSlacker struct {
+	called string
+}
+
+func (r *recordingSlacker) record(name string) error {
+	r.called = name
+	return nil
+}
+
+func (r *recordingSlacker) IssueCreated(*JIRAWebevent) error     { return r.record("IssueCreated") }
+func (r *recordingSlacker) IssueDeleted(JIRAWebevent) error      { return r.record("IssueDeleted") }
+func (r *recordingSlacker) IssueUpdated(JIRAWebevent) error      { return r.record("IssueUpdated") }
+func (r *recordingSlacker) WorklogUpdated(JIRAWebevent) error    { return r.record("WorklogUpdated") }
+func (r *recordingSlacker) CommentCreated(JIRAWebevent) error    { return r.record("CommentCreated") }
+func (r *recordingSlacker) SendErrorNotice(string, *SlackConfig) {}
+
+// dispatcher renders events with the Slacker, for Replay and Deliver
+func dispatcher(s Slacker) func(*JIRAWebevent) error {
+	return func(event *JIRAWebevent) error { return Dispatch(s, event) }
+}
+
+type recordingEventSlacker struct {
+	recordingSlacker
+}
+
+func (r *recordingEventSlacker) CommentChanged(*JIRAWebevent) error {
+	return r.record("CommentChanged")
+}
+func (r *recordingEventSlacker) WorklogChanged(*JIRAWebevent) error {
+	return r.record("WorklogChanged")
+}
+func (r *recordingEventSlacker) IssueLinkChanged(*JIRAWebevent) error {
+	return r.record("IssueLinkChanged")
+}
+func (r *recordingEventSlacker) SprintChanged(*JIRAWebevent) error {
+	return r.record("SprintChanged")
+}
+func (r *recordingEventSlacker) VersionChanged(*JIRAWebevent) error {
+	return r.record("VersionChanged")
+}
+func (r *recordingEventSlacker) ProjectChanged(*JIRAWebevent) error {
+	return r.record("ProjectChanged")
+}
+func (r *recordingEventSlacker) UserChanged(*JIRAWebevent) error {
+	return r.record("UserChanged")
+}
+func (r *recordingEventSlacker) BoardChanged(*JIRAWebevent) error {
+	return r.record("BoardChanged")
+}
+func (r *recordingEventSlacker) AttachmentChanged(*JIRAWebevent) error {
+	return r.record("AttachmentChanged")
+}
+
+func parseString(t *testing.T, body string) JIRAWebevent {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	event, err := Parse(r)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", body, err)
+	}
+	return event
+}
+
+func TestParseEvents(t *testing.T) {
+	event := parseString(t, `{"webhookEvent":"project_created","project":{"id":10000,"key":"PROJ","name":"Project","projectLead":{"name":"mmcfly"}}}`)
+	if event.Project.Id != "10000" || event.Project.ProjectLead.Name != "mmcfly" {
+		t.Errorf("project = %+v", event.Project)
+	}
+
+	event = parseString(t, `{"webhookEvent":"worklog_created","worklog":{"id":"100","issueId":"10001","timeSpent":"1h 30m","timeSpentSeconds":5400,"author":{"name":"mmcfly"}}}`)
+	if event.Worklog.IssueId != "10001" || event.Worklog.TimeSpentSeconds != 5400 {
+		t.Errorf("worklog = %+v", event.Worklog)
+	}
+
+	event = parseString(t, `{"webhookEvent":"issuelink_created","issueLink":{"id":1,"sourceIssueId":10000,"destinationIssueId":10001,"issueLinkType":{"id":10000,"name":"Blocks","outwardName":"blocks","inwardName":"is blocked by"}}}`)
+	if event.IssueLink.DestinationIssueId != 10001 || event.IssueLink.IssueLinkType.OutwardName != "blocks" {
+		t.Errorf("issue link = %+v", event.IssueLink)
+	}
+
+	event = parseString(t, `{"webhookEvent":"attachment_created","attachment":{"id":10010,"filename":"screen.png","size":2048}}`)
+	if event.Attachment.Id != "10010" || event.Attachment.Filename != "screen.png" {
+		t.Errorf("attachment = %+v", event.Attachment)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	tests := map[string]string{
+		EventIssueCreated:              "IssueCreated",
+		EventIssueUpdated:              "IssueUpdated",
+		EventLegacyWorklogUpdated:      "WorklogUpdated",
+		EventCommentCreated:            "CommentCreated",
+		EventCommentDeleted:            "CommentChanged",
+		EventWorklogUpdated:            "WorklogChanged",
+		EventIssueLinkDeleted:          "IssueLinkChanged",
+		EventSprintStarted:             "SprintChanged",
+		EventVersionReleased:           "VersionChanged",
+		EventProjectCreated:            "ProjectChanged",
+		EventUserCreated:               "UserChanged",
+		EventBoardConfigurationChanged: "BoardChanged",
+		EventAttachmentCreated:         "AttachmentChanged",
+	}
+	for name, want := range tests {
+		s := &recordingEventSlacker{}
+		if err := Dispatch(s, &JIRAWebevent{WebhookEvent: name}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if s.called != want {
+			t.Errorf("%s: called %s, want %s", name, s.called, want)
+		}
+	}
+
+	err := Dispatch(&recordingSlacker{}, &JIRAWebevent{WebhookEvent: EventSprintClosed})
+	if !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("got %v, want ErrUnknownEvent", err)
+	}
+
+	e := &JIRAWebevent{WebhookEvent: EventBoardConfigurationChanged}
+	if e.Kind() != "board" || e.Action() != "configuration changed" {
+		t.Errorf("kind %q action %q", e.Kind(), e.Action())
+	}
+}
+
+var _ EventSlacker = (*SlackService)(nil)
@@ -0,0 +1,120 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Regenerate the golden files with go test -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// The corpus of anonymised JIRA Cloud and Server webhook payloads, by
+// flavour, e.g. testdata/webhooks/cloud/issue_created.json
+const webhookCorpus = "testdata/webhooks"
+
+// renderGolden renders the payload with a fresh service and returns what
+// was sent followed by the error, if any. Events the service has no
+// renderer for render nothing.
+func renderGolden(t *testing.T, payload []byte, send func(*JIRAWebevent, *bytes.Buffer) error) []byte {
+	event, err := ParseBytes(payload)
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := send(&event, &out); err != nil && !errors.Is(err, ErrUnknownEvent) {
+		fmt.Fprintf(&out, "error: %v\n", err)
+	}
+	return out.Bytes()
+}
+
+func renderSlackGolden(event *JIRAWebevent, out *bytes.Buffer) error {
+	svc := NewSlackService(nil, &SlackConfig{
+		Channel:     "#jira",
+		BotName:     "JIRA",
+		Domain:      "example",
+		IssueFields: []string{"reporter", "components", "duedate"},
+		Threads:     NewMemoryThreadStore(),
+		DryRun:      out,
+	})
+	return svc.Dispatch(event)
+}
+
+func renderHipGolden(event *JIRAWebevent, out *bytes.Buffer) error {
+	svc, err := NewHipService(nil, &HipConfig{
+		Domain:       "example",
+		ProjectRooms: map[string]string{"PROJ": "Dev"},
+		DefaultRoom:  "JIRA",
+		IssueFields:  []string{"reporter", "components", "duedate"},
+		DryRun:       out,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = svc.Dispatch(event)
+	return err
+}
+
+// checkGolden compares got with the golden file or rewrites it with
+// -update. There is no golden file when nothing was rendered.
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if len(got) == 0 {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && len(got) == 0 {
+		return
+	}
+	if err != nil {
+		t.Fatalf("%v, run go test -run TestGolden -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, run go test -run TestGolden -update if this is intended\ngot:\n%s\nwant:\n%s",
+			path, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	// Every payload was sent three hours ago
+	clock = func() time.Time { return time.Unix(1451901600, 0).Add(3 * time.Hour) }
+	defer func() { clock = time.Now }()
+
+	payloads, err := filepath.Glob(filepath.Join(webhookCorpus, "*", "*.json"))
+	if err != nil || len(payloads) == 0 {
+		t.Fatalf("no payloads in %s: %v", webhookCorpus, err)
+	}
+	for _, path := range payloads {
+		rel, _ := filepath.Rel(webhookCorpus, path)
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".json")
+		t.Run(name, func(t *testing.T) {
+			payload, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "golden", filepath.FromSlash(name))
+			checkGolden(t, golden+".slack", renderGolden(t, payload, renderSlackGolden))
+			checkGolden(t, golden+".hipchat", renderGolden(t, payload, renderHipGolden))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package jirachat
 
 import (
 	"fmt"
+	"html"
 	"net/http"
 )
 
@@ -24,16 +25,195 @@ type NotificationRequest struct {
 	// Determines how the message is treated by our server and rendered inside
 	// HipChat applications
 	MessageFormat string `json:"message_format,omitempty"`
+
+	// A label to be shown in addition to the sender's name
+	From string `json:"from,omitempty"`
+
+	// An optional card rendered in place of the message by clients that
+	// support them. Message is still required and is used as a fallback.
+	Card *Card `json:"card,omitempty"`
+
+	// Link appended to the message when it is truncated
+	moreURL_ string
+	more_    string
+}
+
+// Card is a HipChat card attached to a room notification.
+//
+// HipChat API docs: https://developer.atlassian.com/hipchat/guide/sending-messages#SendingMessages-UsingCards
+type Card struct {
+	// Type of the card.
+	// Valid values: file, image, application, link, media.
+	Style string `json:"style"`
+
+	// Unique identifier of the card. Required.
+	Id string `json:"id"`
+
+	// The title of the card. Required.
+	Title string `json:"title"`
+
+	// The url where the card will open
+	URL string `json:"url,omitempty"`
+
+	// Application cards can be compact (1 to 2 lines) or medium
+	// (1 to 5 lines)
+	Format string `json:"format,omitempty"`
+
+	Description *CardDescription `json:"description,omitempty"`
+	Icon        *Icon            `json:"icon,omitempty"`
+	Thumbnail   *Thumbnail       `json:"thumbnail,omitempty"`
+
+	// Activity cards are rendered as a single line of html followed by
+	// the card itself once expanded
+	Activity *Activity `json:"activity,omitempty"`
+
+	// List of attributes to show below the card. Sample {label}:{value.icon} {value.label}
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+// CardDescription is the text of a card in either html or text format
+type CardDescription struct {
+	Value  string `json:"value"`
+	Format string `json:"format"`
+}
+
+// Icon is an image shown next to card titles and attributes
+type Icon struct {
+	URL   string `json:"url"`
+	URL2x string `json:"url@2x,omitempty"`
+}
+
+// Thumbnail is an image shown on the side of a card
+type Thumbnail struct {
+	URL    string `json:"url"`
+	URL2x  string `json:"url@2x,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// Activity describes the line shown for activity cards
+type Activity struct {
+	HTML string `json:"html"`
+	Icon *Icon  `json:"icon,omitempty"`
+}
+
+// Attribute is a single label/value pair shown on a card
+type Attribute struct {
+	Label string         `json:"label,omitempty"`
+	Value AttributeValue `json:"value"`
+}
+
+// AttributeValue is the value of a card attribute. Style is one of the
+// lozenge styles, e.g. lozenge-success, lozenge-error, lozenge-current.
+type AttributeValue struct {
+	Label string `json:"label"`
+	URL   string `json:"url,omitempty"`
+	Style string `json:"style,omitempty"`
+	Icon  *Icon  `json:"icon,omitempty"`
 }
 
-/// Notification sends a notification to the room specified by the id.
+// Notification sends a notification to the room specified by the id or
+// name. Names are resolved to ids with RoomId. Messages longer than
+// HipChat allows are truncated.
 //
 // HipChat API docs: https://www.hipchat.com/docs/apiv2/method/send_room_notification
-func (r *hipService) Notification(id string, notifReq *NotificationRequest) (*http.Response, error) {
-	req, err := r.config_.newRequest("POST", fmt.Sprintf("room/%s/notification", id), notifReq)
+func (r *hipService) Notification(idOrName string, notifReq *NotificationRequest) (*http.Response, error) {
+	id, err := r.RoomId(idOrName)
 	if err != nil {
 		return nil, err
 	}
 
-	return r.config_.do(req, nil)
+	truncated := *notifReq
+	truncated.truncate()
+	req, err := r.config_.NewRequest("POST", fmt.Sprintf("room/%s/notification", id), &truncated)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.config_.Do(req, nil)
+}
+
+// GetIssueCard returns an application card describing the event's issue.
+// Activity cards render the user's action on the issue as a single line
+// which expands to show the issue details.
+func (e *JIRAWebevent) GetIssueCard(c *HipConfig, activity bool) *Card {
+	link := fmt.Sprintf(issueLinkBase, c.Domain, e.Issue.Key)
+	fields := e.Issue.Fields
+
+	card := &Card{
+		Style:  CardStyleApplication,
+		Id:     e.Issue.Id,
+		Title:  fmt.Sprintf("%s: %s", e.Issue.Key, fields.Summary),
+		URL:    link,
+		Format: CardFormatMedium,
+		Description: &CardDescription{
+			Value:  TruncateHTML(fields.Description.HTML(), MaxHipCardLength, link, moreIssue),
+			Format: FormatHTML,
+		},
+	}
+	if len(fields.IssueType.IconURL) > 0 {
+		card.Icon = &Icon{URL: fields.IssueType.IconURL}
+	}
+
+	assignee := fields.Assignee.DisplayName
+	if len(assignee) == 0 {
+		assignee = "unassigned"
+	}
+	card.Attributes = []Attribute{
+		{Label: "Status", Value: AttributeValue{
+			Label: fields.Status.Name,
+			Style: "lozenge-current",
+		}},
+		{Label: "Priority", Value: AttributeValue{Label: fields.Priority.Name}},
+		{Label: "Assignee", Value: AttributeValue{Label: assignee}},
+	}
+	card.Attributes = append(card.Attributes, c.issueAttributes(&fields)...)
+
+	if activity {
+		verb := "updated"
+		if e.WebhookEvent == EventIssueCreated {
+			verb = "created"
+		}
+		card.Activity = &Activity{
+			HTML: fmt.Sprintf("<b>%s</b> %s <a href=\"%s\">%s</a>",
+				html.EscapeString(e.User.DisplayName), verb, link,
+				html.EscapeString(e.Issue.Key)),
+		}
+		if avatar := e.User.SmallAvatar(); len(avatar) > 0 {
+			card.Activity.Icon = &Icon{URL: avatar}
+		}
+	}
+	return card
+}
+
+// IssueNotification sends the event's issue as an activity card to the
+// room of its project. Clients without card support show the activity
+// line, followed by the age of late events.
+func (r *hipService) IssueNotification(event *JIRAWebevent) (*http.Response, error) {
+	card := event.GetIssueCard(r.config_, true)
+	return r.ProjectNotification(event, &NotificationRequest{
+		Message:       card.Activity.HTML + html.EscapeString(event.age()),
+		Color:         event.GetHipColor(r.config_),
+		Notify:        event.WebhookEvent == EventIssueCreated,
+		MessageFormat: FormatHTML,
+		Card:          card,
+	})
+}
+
+// Dispatch sends the event with the default HipChat renderer for its
+// type: issue cards for issue events and announcements for started and
+// closed sprints and released versions. Other events return
+// ErrUnknownEvent.
+func (r *hipService) Dispatch(event *JIRAWebevent) (*http.Response, error) {
+	switch event.WebhookEvent {
+	case EventIssueCreated, EventIssueUpdated:
+		return r.IssueNotification(event)
+	case EventSprintStarted, EventSprintClosed, EventVersionReleased:
+		a, err := NewAnnouncement(event, nil, r.config_.Domain)
+		if err != nil {
+			return nil, err
+		}
+		return r.Announce(a)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, event.WebhookEvent)
 }
@@ -0,0 +1,91 @@
+package jirachat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetIssueCard(t *testing.T) {
+	event := parseString(t, `{
+		"webhookEvent": "jira:issue_created",
+		"user": {"name": "biff", "displayName": "Biff <Tannen>",
+			"avatarUrls": {"16x16": "https://example.com/biff.png"}},
+		"issue": {"id": "10001", "key": "PROJ-1", "fields": {
+			"summary": "Fix the flux capacitor",
+			"description": "It needs *1.21* gigawatts",
+			"issuetype": {"name": "Bug", "iconUrl": "https://example.com/bug.png"},
+			"priority": {"name": "High"},
+			"status": {"name": "Open"}
+		}}
+	}`)
+	c := &HipConfig{Domain: "example"}
+
+	card := event.GetIssueCard(c, false)
+	if card.Title != "PROJ-1: Fix the flux capacitor" ||
+		card.URL != "https://example.atlassian.net/browse/PROJ-1" ||
+		card.Icon == nil || card.Icon.URL != "https://example.com/bug.png" || card.Activity != nil {
+		t.Errorf("card = %+v", card)
+	}
+	if !strings.Contains(card.Description.Value, "<b>1.21</b>") {
+		t.Errorf("description = %q", card.Description.Value)
+	}
+	want := []string{"Status: Open", "Priority: High", "Assignee: unassigned"}
+	if len(card.Attributes) != len(want) {
+		t.Fatalf("attributes = %+v", card.Attributes)
+	}
+	for i, attr := range card.Attributes {
+		if got := attr.Label + ": " + attr.Value.Label; got != want[i] {
+			t.Errorf("attribute %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	card = event.GetIssueCard(c, true)
+	if card.Activity == nil ||
+		card.Activity.HTML != `<b>Biff &lt;Tannen&gt;</b> created <a href="https://example.atlassian.net/browse/PROJ-1">PROJ-1</a>` ||
+		card.Activity.Icon == nil || card.Activity.Icon.URL != "https://example.com/biff.png" {
+		t.Errorf("activity = %+v", card.Activity)
+	}
+}
+
+func TestPrivateMessage(t *testing.T) {
+	svc, hip := newHipTest(t, &HipConfig{})
+	_, err := svc.PrivateMessage("marty@example.com", &MessageRequest{
+		Message: strings.Repeat("x", MaxHipMessageLength+10),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := hip.Requests()
+	var msg MessageRequest
+	if len(reqs) != 1 || reqs[0].Path != "/v2/user/marty@example.com/message" ||
+		reqs[0].JSON(&msg) != nil || len(msg.Message) > MaxHipMessageLength {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestHipTruncateLink(t *testing.T) {
+	svc, hip := newHipTest(t, &HipConfig{
+		Domain:       "example",
+		ProjectRooms: map[string]string{"PROJ": "Dev"},
+	})
+	event := parseString(t, `{"webhookEvent": "comment_created",
+		"comment": {"id": "100", "body": "Great Scott!"},
+		"issue": {"key": "PROJ-1", "fields": {"project": {"key": "PROJ"}}}}`)
+	_, err := svc.ProjectNotification(&event, &NotificationRequest{
+		Message:       "<b>" + strings.Repeat("gigawatts ", MaxHipMessageLength/10+1) + "</b>",
+		MessageFormat: FormatHTML,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var note NotificationRequest
+	notes := hip.Notifications()
+	if len(notes) != 1 || notes[0].JSON(&note) != nil {
+		t.Fatalf("notifications = %+v", notes)
+	}
+	want := `</b>… <a href="https://example.atlassian.net/browse/PROJ-1?focusedCommentId=100#comment-100">view full comment</a>`
+	if len(note.Message) > MaxHipMessageLength || !strings.HasSuffix(note.Message, want) {
+		t.Errorf("message ends with %q", note.Message[len(note.Message)-120:])
+	}
+}
@@ -0,0 +1,144 @@
+package jirachat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrNoRoom = errors.New("no HipChat room configured for project")
+
+// Room represents a HipChat room.
+type Room struct {
+	Id                int    `json:"id"`
+	Name              string `json:"name"`
+	Topic             string `json:"topic"`
+	Privacy           string `json:"privacy"`
+	IsArchived        bool   `json:"is_archived"`
+	IsGuestAccessible bool   `json:"is_guest_accessible"`
+	XmppJid           string `json:"xmpp_jid"`
+	Links             Links  `json:"links"`
+}
+
+// Links are the HipChat API links of a resource
+type Links struct {
+	Self     string `json:"self"`
+	Webhooks string `json:"webhooks,omitempty"`
+	Members  string `json:"members,omitempty"`
+}
+
+// SetTopicRequest represents a HipChat room topic update request.
+type SetTopicRequest struct {
+	// The topic body.
+	// Valid length range: 0 - 250.
+	Topic string `json:"topic"`
+}
+
+// GetRoom returns the room specified by its id or name.
+//
+// HipChat API docs: https://www.hipchat.com/docs/apiv2/method/get_room
+func (r *hipService) GetRoom(idOrName string) (*Room, *http.Response, error) {
+	req, err := r.config_.NewRequest("GET",
+		fmt.Sprintf("room/%s", url.PathEscape(idOrName)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	room := new(Room)
+	resp, err := r.config_.Do(req, room)
+	if err != nil {
+		return nil, resp, err
+	}
+	return room, resp, nil
+}
+
+// SetTopic sets the topic of the room specified by its id or name, e.g. to
+// announce the current sprint.
+//
+// HipChat API docs: https://www.hipchat.com/docs/apiv2/method/set_topic
+func (r *hipService) SetTopic(idOrName, topic string) (*http.Response, error) {
+	req, err := r.config_.NewRequest("PUT",
+		fmt.Sprintf("room/%s/topic", url.PathEscape(idOrName)),
+		&SetTopicRequest{Topic: topic})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.config_.Do(req, nil)
+}
+
+// roomCache remembers the ids of rooms resolved by name. It lives on the
+// HipConfig so it survives across the per-request hipService instances.
+type roomCache struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newRoomCache() *roomCache {
+	return &roomCache{ids: make(map[string]string)}
+}
+
+// RoomId resolves a room name to its numeric id. Ids are returned as is,
+// names are looked up once and cached.
+func (r *hipService) RoomId(idOrName string) (string, error) {
+	// Names can't be looked up in dry runs
+	if _, err := strconv.Atoi(idOrName); err == nil || r.config_.DryRun != nil {
+		return idOrName, nil
+	}
+
+	cache := r.config_.rooms_
+	cache.mu.Lock()
+	id, ok := cache.ids[idOrName]
+	cache.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	room, _, err := r.GetRoom(idOrName)
+	if err != nil {
+		return "", err
+	}
+	id = strconv.Itoa(room.Id)
+
+	cache.mu.Lock()
+	cache.ids[idOrName] = id
+	cache.mu.Unlock()
+	return id, nil
+}
+
+// ProjectRoom returns the id of the room mapped to the JIRA project key,
+// falling back to the configured DefaultRoom.
+func (r *hipService) ProjectRoom(projectKey string) (string, error) {
+	room, ok := r.config_.ProjectRooms[projectKey]
+	if !ok {
+		room = r.config_.DefaultRoom
+	}
+	if len(room) == 0 {
+		return "", fmt.Errorf("%w %s", ErrNoRoom, projectKey)
+	}
+	return r.RoomId(room)
+}
+
+// ProjectNotification sends a notification to the room mapped to the
+// project of the event's issue. Truncated messages link to the event's
+// comment or issue.
+func (r *hipService) ProjectNotification(event *JIRAWebevent, notifReq *NotificationRequest) (*http.Response, error) {
+	key := event.Issue.Fields.Project.Key
+	if len(key) == 0 {
+		// Some payloads omit the project, the issue key always starts
+		// with it
+		key = strings.SplitN(event.Issue.Key, "-", 2)[0]
+	}
+
+	id, err := r.ProjectRoom(key)
+	if err != nil {
+		return nil, err
+	}
+	linked := *notifReq
+	linked.moreURL_, linked.more_ = event.moreLink(r.config_.Domain)
+	return r.Notification(id, &linked)
+}
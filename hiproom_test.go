@@ -0,0 +1,70 @@
+package jirachat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+// newHipTest starts a fake HipChat with a Dev room and a service using it
+func newHipTest(t *testing.T, config *HipConfig) (*hipService, *jirachattest.HipChatServer) {
+	t.Helper()
+	hip := jirachattest.NewHipChatServer("secret", jirachattest.HipChatRoom{Id: 42, Name: "Dev"})
+	t.Cleanup(hip.Close)
+	config.Token = "secret"
+	config.BaseURL = hip.BaseURL()
+	svc, err := NewHipService(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, hip
+}
+
+func TestSetTopic(t *testing.T) {
+	svc, _ := newHipTest(t, &HipConfig{})
+	if _, err := svc.SetTopic("Dev", "Sprint 7: 88 mph"); err != nil {
+		t.Fatal(err)
+	}
+	room, _, err := svc.GetRoom("42")
+	if err != nil || room.Topic != "Sprint 7: 88 mph" {
+		t.Errorf("room = %+v, %v", room, err)
+	}
+
+	if _, err := svc.SetTopic("Ops", "lost"); err == nil {
+		t.Error("unknown room accepted")
+	}
+}
+
+func TestRoomId(t *testing.T) {
+	svc, hip := newHipTest(t, &HipConfig{
+		ProjectRooms: map[string]string{"PROJ": "Dev"},
+	})
+
+	for i := 0; i < 2; i++ {
+		if id, err := svc.RoomId("Dev"); err != nil || id != "42" {
+			t.Fatalf("RoomId(Dev) = %q, %v", id, err)
+		}
+	}
+	if id, err := svc.RoomId("7"); err != nil || id != "7" {
+		t.Errorf("RoomId(7) = %q, %v", id, err)
+	}
+	if n := len(hip.Requests()); n != 1 {
+		t.Errorf("looked up rooms %d times, want once", n)
+	}
+
+	if _, err := svc.RoomId("Ops"); err == nil {
+		t.Error("unknown room resolved")
+	}
+
+	if id, err := svc.ProjectRoom("PROJ"); err != nil || id != "42" {
+		t.Errorf("ProjectRoom(PROJ) = %q, %v", id, err)
+	}
+	if _, err := svc.ProjectRoom("OTHER"); !errors.Is(err, ErrNoRoom) {
+		t.Errorf("ProjectRoom(OTHER) = %v, want ErrNoRoom", err)
+	}
+	svc.config_.DefaultRoom = "Dev"
+	if id, err := svc.ProjectRoom("OTHER"); err != nil || id != "42" {
+		t.Errorf("ProjectRoom(OTHER) with default = %q, %v", id, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 // Base API URL
@@ -21,9 +22,46 @@ const (
 // Config manages service resources
 type HipConfig struct {
 	// Hipchat access token
-	Token    string
+	Token string
+
+	// Optional API base URL, defaults to https://api.hipchat.com/v2/
+	BaseURL string
+
+	// JIRA domain name, used to link cards back to issues
+	Domain string
+
+	// Optional mapping of JIRA project keys to the room id or name which
+	// receives notifications for that project
+	ProjectRooms map[string]string
+
+	// Room id or name used for projects missing from ProjectRooms
+	DefaultRoom string
+
+	// Optional scheme choosing message colors. Defaults to
+	// DefaultColorScheme.
+	Colors *ColorScheme
+
+	// Additional attributes shown on issue cards, by JIRA field id or
+	// custom field name. See IssueFieldData.FieldText.
+	IssueFields []string
+
+	// Optional writer receiving every request as JSON instead of it being
+	// sent to HipChat, to preview rendering changes. No Token is needed.
+	DryRun io.Writer
+
+	// Optional HTTP client used for every request, e.g. one with a proxy,
+	// client certificates or tracing. Takes precedence over Transport.
+	Client *http.Client
+
+	// Optional transport used with a default client when Client is not
+	// set, e.g. URLFetchTransport on the legacy App Engine runtime. With
+	// neither set, as on App Engine's second generation runtimes, net/http's
+	// default transport is used.
+	Transport http.RoundTripper
+
 	baseURL_ *url.URL
 	client_  *http.Client
+	rooms_   *roomCache
 }
 
 // HipService gives access to post messages to Hipchat
@@ -33,14 +71,23 @@ type hipService struct {
 
 // NewClient returns a new HipChat API client
 func NewHipService(r *http.Request, config *HipConfig) (*hipService, error) {
-	baseUrl, err := url.Parse(defaultBaseURL)
+	base := config.BaseURL
+	if len(base) == 0 {
+		base = defaultBaseURL
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	baseUrl, err := url.Parse(base)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	client := getHttpClient(r)
-	config.client_ = &client
+	config.client_ = newHttpClient(config.Client, config.Transport)
 	config.baseURL_ = baseUrl
+	if config.rooms_ == nil {
+		config.rooms_ = newRoomCache()
+	}
 
 	if err = config.IsValid(); err != nil {
 		return nil, err
@@ -52,7 +99,7 @@ func NewHipService(r *http.Request, config *HipConfig) (*hipService, error) {
 
 // Returns true if the configuration appears valid
 func (c *HipConfig) IsValid() error {
-	if len(c.Token) == 0 {
+	if len(c.Token) == 0 && c.DryRun == nil {
 		return errors.New("Invalid Hipchat Token")
 	}
 	return nil
@@ -62,7 +109,7 @@ func (c *HipConfig) IsValid() error {
 // API request not implemented in this library. Otherwise it should not be
 // be used directly.
 // Relative URLs should always be specified without a preceding slash.
-func (c *HipConfig) newRequest(method, urlStr string, body interface{}) (*http.Request, error) {
+func (c *HipConfig) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
 	rel, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, err
@@ -92,7 +139,10 @@ func (c *HipConfig) newRequest(method, urlStr string, body interface{}) (*http.R
 // and stored in the value pointed by v.
 // Do can be used to perform the request created with NewRequest, as the latter
 // it should be used only for API requests not implemented in this library.
-func (c *HipConfig) do(req *http.Request, v interface{}) (*http.Response, error) {
+func (c *HipConfig) Do(req *http.Request, v interface{}) (*http.Response, error) {
+	if c.DryRun != nil {
+		return c.dryRunDo(req)
+	}
 	resp, err := c.client_.Do(req)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,43 @@
+package jirachat
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// MessageRequest represents a HipChat private message to a user.
+type MessageRequest struct {
+	// The message body
+	// Valid length range: 1 - 10000.
+	Message string `json:"message"`
+
+	// Whether this message should trigger a user notification
+	Notify bool `json:"notify,omitempty"`
+
+	// Determines how the message is treated by our server and rendered inside
+	// HipChat applications
+	// Valid values: html, text.
+	MessageFormat string `json:"message_format,omitempty"`
+
+	// Link appended to the message when it is truncated
+	moreURL_ string
+	more_    string
+}
+
+// PrivateMessage sends a private message to the user specified by their
+// id, email or @mention name. Messages longer than HipChat allows are
+// truncated.
+//
+// HipChat API docs: https://www.hipchat.com/docs/apiv2/method/private_message_user
+func (r *hipService) PrivateMessage(idOrEmail string, msgReq *MessageRequest) (*http.Response, error) {
+	truncated := *msgReq
+	truncated.truncate()
+	req, err := r.config_.NewRequest("POST",
+		fmt.Sprintf("user/%s/message", url.PathEscape(idOrEmail)), &truncated)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.config_.Do(req, nil)
+}
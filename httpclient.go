@@ -0,0 +1,16 @@
+package jirachat
+
+import (
+	"net/http"
+)
+
+// newHttpClient returns the client used to reach Slack, HipChat or JIRA:
+// the configured client, else a client using the configured transport,
+// else one using net/http's default transport. On the legacy App Engine
+// runtime pass URLFetchTransport, see jirachat_gae.go.
+func newHttpClient(client *http.Client, transport http.RoundTripper) *http.Client {
+	if client != nil {
+		return client
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,86 @@
+package jirachat
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// recorder is a transport answering every request with a canned body and
+// remembering the URLs requested
+type recorder struct {
+	body string
+	urls []string
+}
+
+func (t *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.urls = append(t.urls, req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestTransport(t *testing.T) {
+	slack := &recorder{body: "ok"}
+	svc := NewSlackService(nil, &SlackConfig{
+		Channel:    "#dev",
+		Domain:     "example",
+		WebhookUrl: "https://hooks.slack.com/services/T0/B0/X",
+		Transport:  slack,
+	})
+	event := parseString(t, dryRunPayload)
+	if err := svc.Dispatch(&event); err != nil {
+		t.Fatal(err)
+	}
+	if len(slack.urls) != 1 || slack.urls[0] != "https://hooks.slack.com/services/T0/B0/X" {
+		t.Errorf("slack requests = %v", slack.urls)
+	}
+
+	hip := &recorder{body: `{"id": 42, "name": "Dev"}`}
+	hipSvc, err := NewHipService(nil, &HipConfig{Token: "secret", Transport: hip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room, _, err := hipSvc.GetRoom("Dev"); err != nil || room.Id != 42 {
+		t.Errorf("room = %+v, %v", room, err)
+	}
+	if len(hip.urls) != 1 || hip.urls[0] != "https://api.hipchat.com/v2/room/Dev" {
+		t.Errorf("hipchat requests = %v", hip.urls)
+	}
+
+	jira := &recorder{body: `{"key": "PROJ-1"}`}
+	client, err := NewJIRAClient(nil, &JIRAConfig{Domain: "example", Transport: jira})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue, err := client.GetIssue("PROJ-1"); err != nil || issue.Key != "PROJ-1" {
+		t.Errorf("issue = %+v, %v", issue, err)
+	}
+	if len(jira.urls) != 1 || !strings.HasPrefix(jira.urls[0], "https://example.atlassian.net/rest/api/2/issue/PROJ-1") {
+		t.Errorf("jira requests = %v", jira.urls)
+	}
+}
+
+func TestClientOverTransport(t *testing.T) {
+	transport := &recorder{body: "ok"}
+	client := &http.Client{Transport: &recorder{body: "ok"}}
+	if c := newHttpClient(client, transport); c != client {
+		t.Error("Client not preferred over Transport")
+	}
+	if c := newHttpClient(nil, transport); c.Transport != transport {
+		t.Error("Transport not used")
+	}
+	if c := newHttpClient(nil, nil); c == nil || c.Transport != nil {
+		t.Errorf("default client = %+v", c)
+	}
+
+	// Configs used without a service still get a client
+	config := &SlackConfig{Transport: transport}
+	if c := config.httpClient(); c.Transport != transport {
+		t.Error("SlackConfig without a service ignores Transport")
+	}
+}
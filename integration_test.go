@@ -0,0 +1,98 @@
+package jirachat
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+func TestSlackWebhookIntegration(t *testing.T) {
+	slack := jirachattest.NewSlackServer("")
+	defer slack.Close()
+	svc := NewSlackService(nil, &SlackConfig{
+		Channel:    "#dev",
+		Domain:     "example",
+		WebhookUrl: slack.WebhookURL(),
+	})
+	event := parseString(t, dryRunPayload)
+
+	if err := svc.Dispatch(&event); err != nil {
+		t.Fatal(err)
+	}
+	msgs := slack.Messages()
+	var msg SlackMessage
+	if len(msgs) != 1 || msgs[0].JSON(&msg) != nil || msg.Channel != "#dev" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+
+	// A failing webhook is reported rather than dropped silently
+	slack.InjectFault(jirachattest.Fault{Status: http.StatusNotFound, Body: "channel_not_found"})
+	if err := svc.Dispatch(&event); err == nil {
+		t.Error("webhook failure not reported")
+	}
+}
+
+func TestSlackThreadIntegration(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	svc := NewSlackService(nil, &SlackConfig{
+		Channel: "C024BE91L",
+		Domain:  "example",
+		ApiUrl:  slack.ApiURL(),
+		Token:   "xoxb-test",
+		Threads: NewMemoryThreadStore(),
+	})
+
+	created := parseString(t, dryRunPayload)
+	if err := svc.IssueCreated(&created); err != nil {
+		t.Fatal(err)
+	}
+	comment := parseString(t, `{"webhookEvent": "comment_created",
+		"comment": {"id": "1", "body": "Great Scott!", "author": {"name": "dbrown", "displayName": "Emmett Brown"}},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Fix the flux capacitor"}}}`)
+	if err := svc.CommentCreated(&comment); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := slack.Messages()
+	var reply SlackMessage
+	if len(msgs) != 2 || msgs[1].JSON(&reply) != nil || reply.ThreadTs != "1451901600.000001" {
+		t.Errorf("comment not threaded: %+v", reply)
+	}
+
+	slack.InjectFault(jirachattest.Fault{Status: http.StatusTooManyRequests, RetryAfter: 30})
+	if err := svc.CommentCreated(&comment); err == nil {
+		t.Error("rate limit not reported")
+	}
+}
+
+func TestHipChatIntegration(t *testing.T) {
+	hip := jirachattest.NewHipChatServer("secret", jirachattest.HipChatRoom{Id: 42, Name: "Dev"})
+	defer hip.Close()
+	svc, err := NewHipService(nil, &HipConfig{
+		Token:        "secret",
+		BaseURL:      hip.BaseURL(),
+		Domain:       "example",
+		ProjectRooms: map[string]string{"PROJ": "Dev"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := parseString(t, dryRunPayload)
+
+	if _, err := svc.Dispatch(&event); err != nil {
+		t.Fatal(err)
+	}
+	notes := hip.Notifications()
+	var note NotificationRequest
+	if len(notes) != 1 || notes[0].Path != "/v2/room/42/notification" ||
+		notes[0].JSON(&note) != nil || note.Card == nil {
+		t.Fatalf("notifications = %+v", notes)
+	}
+
+	hip.InjectFault(jirachattest.Fault{Status: http.StatusInternalServerError})
+	if _, err := svc.Dispatch(&event); err == nil {
+		t.Error("server error not reported")
+	}
+}
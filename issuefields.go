@@ -0,0 +1,188 @@
+package jirachat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Titles of the fields known to FieldText, by JIRA field id
+var fieldTitles = map[string]string{
+	"assignee":       "Assignee",
+	"attachment":     "Attachments",
+	"components":     "Components",
+	"creator":        "Creator",
+	"duedate":        "Due",
+	"environment":    "Environment",
+	"fixVersions":    "Fix Versions",
+	"issuelinks":     "Links",
+	"issuetype":      "Type",
+	"labels":         "Labels",
+	"parent":         "Parent",
+	"priority":       "Priority",
+	"project":        "Project",
+	"reporter":       "Reporter",
+	"resolution":     "Resolution",
+	"resolutiondate": "Resolved",
+	"status":         "Status",
+	"subtasks":       "Sub-tasks",
+	"timetracking":   "Time Tracking",
+	"versions":       "Affects Versions",
+	"watches":        "Watchers",
+}
+
+// FieldText returns the title and plain text value of the field with the
+// given JIRA id, e.g. fixVersions or duedate, or of the custom field with
+// the given name or id. The value is empty when the field is not set.
+func (f *IssueFieldData) FieldText(name string) (title, value string) {
+	title, ok := fieldTitles[name]
+	if !ok {
+		custom := f.Custom(name)
+		title = custom.Name
+		if len(title) == 0 {
+			title = name
+		}
+		return title, custom.String()
+	}
+
+	switch name {
+	case "assignee":
+		value = f.Assignee.DisplayName
+	case "attachment":
+		names := make([]string, 0, len(f.Attachments))
+		for _, a := range f.Attachments {
+			names = append(names, a.Filename)
+		}
+		value = strings.Join(names, ", ")
+	case "components":
+		names := make([]string, 0, len(f.Components))
+		for _, c := range f.Components {
+			names = append(names, c.Name)
+		}
+		value = strings.Join(names, ", ")
+	case "creator":
+		value = f.Creator.DisplayName
+	case "duedate":
+		if !f.DueDate.IsZero() {
+			value = f.DueDate.Format(jiraDateLayout)
+		}
+	case "environment":
+		value = f.Environment.Text()
+	case "fixVersions":
+		value = versionNames(f.FixVersions)
+	case "issuelinks":
+		lines := make([]string, 0, len(f.IssueLinks))
+		for _, link := range f.IssueLinks {
+			if link.OutwardIssue != nil {
+				lines = append(lines, link.Type.Outward+" "+issueLine(link.OutwardIssue))
+			} else if link.InwardIssue != nil {
+				lines = append(lines, link.Type.Inward+" "+issueLine(link.InwardIssue))
+			}
+		}
+		value = strings.Join(lines, "\n")
+	case "issuetype":
+		value = f.IssueType.Name
+	case "labels":
+		value = strings.Join(f.Labels, ", ")
+	case "parent":
+		if f.Parent != nil {
+			value = issueLine(f.Parent)
+		}
+	case "priority":
+		value = f.Priority.Name
+	case "project":
+		value = f.Project.Name
+	case "reporter":
+		value = f.Reporter.DisplayName
+	case "resolution":
+		value = f.Resolution.Name
+	case "resolutiondate":
+		if !f.ResolutionDate.IsZero() {
+			value = f.ResolutionDate.Format(jiraDateLayout)
+		}
+	case "status":
+		value = f.Status.Name
+	case "subtasks":
+		lines := make([]string, 0, len(f.Subtasks))
+		for i := range f.Subtasks {
+			lines = append(lines, fmt.Sprintf("%s (%s)", issueLine(&f.Subtasks[i]),
+				f.Subtasks[i].Fields.Status.Name))
+		}
+		value = strings.Join(lines, "\n")
+	case "timetracking":
+		value = f.TimeTracking.String()
+	case "versions":
+		value = versionNames(f.AffectedVersions)
+	case "watches":
+		if f.Watches.WatchCount > 0 {
+			value = strconv.Itoa(f.Watches.WatchCount)
+		}
+	}
+	return title, value
+}
+
+// issueLine describes a linked issue, e.g. PROJ-1 Fix it
+func issueLine(issue *JIRAIssue) string {
+	return strings.TrimSpace(issue.Key + " " + issue.Fields.Summary)
+}
+
+func versionNames(versions []JIRAVersion) string {
+	names := make([]string, 0, len(versions))
+	for _, v := range versions {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// String describes the time tracking, e.g. 3h spent, 1d remaining of 2d
+func (t JIRATimeTracking) String() string {
+	var parts []string
+	if len(t.TimeSpent) > 0 {
+		parts = append(parts, t.TimeSpent+" spent")
+	}
+	if len(t.RemainingEstimate) > 0 {
+		remaining := t.RemainingEstimate + " remaining"
+		if len(t.OriginalEstimate) > 0 {
+			remaining += " of " + t.OriginalEstimate
+		}
+		parts = append(parts, remaining)
+	} else if len(t.OriginalEstimate) > 0 {
+		parts = append(parts, t.OriginalEstimate+" estimated")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// issueFields returns the Slack fields for the configured IssueFields
+// that are set on the issue
+func (c *SlackConfig) issueFields(fields *IssueFieldData) []Field {
+	var out []Field
+	for _, name := range c.IssueFields {
+		title, value := fields.FieldText(name)
+		if len(value) == 0 {
+			continue
+		}
+		out = append(out, Field{
+			Title: title,
+			Value: value,
+			Short: len(value) < 40 && !strings.Contains(value, "\n"),
+		})
+	}
+	return out
+}
+
+// issueAttributes returns the card attributes for the configured
+// IssueFields that are set on the issue
+func (c *HipConfig) issueAttributes(fields *IssueFieldData) []Attribute {
+	var out []Attribute
+	for _, name := range c.IssueFields {
+		title, value := fields.FieldText(name)
+		if len(value) == 0 {
+			continue
+		}
+		out = append(out, Attribute{
+			Label: title,
+			Value: AttributeValue{Label: strings.Replace(value, "\n", ", ", -1)},
+		})
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testIssue = `{
+	"key": "PROJ-2",
+	"fields": {
+		"summary": "Build it",
+		"reporter": {"name": "dbrown", "displayName": "Doc Brown"},
+		"components": [{"id": "1", "name": "API"}, {"id": "2", "name": "Web"}],
+		"fixVersions": [{"id": "10", "name": "1.2"}],
+		"resolution": {"id": "1", "name": "Fixed"},
+		"resolutiondate": "2016-01-10T17:30:00.000+0100",
+		"duedate": "2016-01-18",
+		"parent": {"key": "PROJ-1", "fields": {"summary": "Ship it"}},
+		"issuelinks": [
+			{"id": "5", "type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"},
+				"outwardIssue": {"key": "PROJ-3", "fields": {"summary": "Test it"}}},
+			{"id": "6", "type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"},
+				"inwardIssue": {"key": "PROJ-4"}}
+		],
+		"watches": {"watchCount": 3},
+		"timetracking": {"originalEstimate": "2d", "remainingEstimate": "1d", "timeSpent": "1d"},
+		"environment": "*Chrome* on macOS"
+	}
+}`
+
+func TestIssueFields(t *testing.T) {
+	var issue JIRAIssue
+	if err := json.Unmarshal([]byte(testIssue), &issue); err != nil {
+		t.Fatal(err)
+	}
+	f := &issue.Fields
+
+	if f.ResolutionDate.Hour() != 17 || !f.DueDate.IsDate() {
+		t.Errorf("dates = %v, %v", f.ResolutionDate, f.DueDate)
+	}
+
+	tests := []struct{ name, title, value string }{
+		{"reporter", "Reporter", "Doc Brown"},
+		{"components", "Components", "API, Web"},
+		{"fixVersions", "Fix Versions", "1.2"},
+		{"resolution", "Resolution", "Fixed"},
+		{"duedate", "Due", "2016-01-18"},
+		{"parent", "Parent", "PROJ-1 Ship it"},
+		{"issuelinks", "Links", "blocks PROJ-3 Test it\nis blocked by PROJ-4"},
+		{"watches", "Watchers", "3"},
+		{"timetracking", "Time Tracking", "1d spent, 1d remaining of 2d"},
+		{"environment", "Environment", "Chrome on macOS"},
+		{"subtasks", "Sub-tasks", ""},
+	}
+	for _, tt := range tests {
+		title, value := f.FieldText(tt.name)
+		if title != tt.title || value != tt.value {
+			t.Errorf("%s = %q, %q, want %q, %q", tt.name, title, value, tt.title, tt.value)
+		}
+	}
+
+	data, err := json.Marshal(f.DueDate)
+	if err != nil || string(data) != `"2016-01-18"` {
+		t.Errorf("marshal due date = %s, %v", data, err)
+	}
+}
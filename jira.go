@@ -2,7 +2,6 @@ package jirachat
 
 import (
 	"encoding/json"
-	"github.com/buger/jsonparser"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -14,8 +13,8 @@ type JIRAWebevent struct {
 	// Internal ID of the event
 	Id int `json:"id,omitempty"`
 
-	// Unix timestamp
-	Timestamp int `json:"timestamp,omitempty"`
+	// When the event happened, sent as milliseconds since the epoch
+	Timestamp JIRATime `json:"timestamp,omitempty"`
 
 	// Object describing issue event relates to
 	Issue JIRAIssue `json:"issue"`
@@ -30,8 +29,39 @@ type JIRAWebevent struct {
 	// Set if this event is a jira_updated event and a comment was made
 	Comment JIRAComment `json:"comment"`
 
+	// Set for worklog_* events
+	Worklog JIRAWorklog `json:"worklog"`
+
+	// Set for issuelink_* events
+	IssueLink JIRAIssueLink `json:"issueLink"`
+
+	// Set for sprint_* events
+	Sprint JIRASprint `json:"sprint"`
+
+	// Set for jira:version_* events
+	Version JIRAVersion `json:"version"`
+
+	// Set for project_* events. User events carry the user in User.
+	Project JIRAProject `json:"project"`
+
+	// Set for board_* events
+	Board JIRABoard `json:"board"`
+
+	// Set for attachment_* events
+	Attachment JIRAAttachment `json:"attachment"`
+
 	// The type of event
 	WebhookEvent string `json:"webhookEvent"`
+
+	// The payload exactly as received, set by Parse and ParseBytes
+	Raw json.RawMessage `json:"-"`
+
+	// Top level fields of the payload this library doesn't know, written
+	// back by MarshalJSON
+	Extra map[string]json.RawMessage `json:"-"`
+
+	// Keys of the payload, set when decoded
+	keys_ map[string]bool
 }
 
 // Decribes the JIRAIssue object defined in the JIRA 5.1 REST docs
@@ -51,6 +81,13 @@ type JIRAIssue struct {
 	// There are quite a few fields and that ones provided in this library
 	// are nowhere near exhaustive.
 	Fields IssueFieldData `json:"fields"`
+
+	// Field names by id, only set when the names expansion was requested
+	Names map[string]string `json:"names,omitempty"`
+
+	// Keys and unknown fields the issue was decoded with
+	keys_  map[string]bool
+	extra_ map[string]json.RawMessage
 }
 
 // Describes the JIRAUser object defined in the JIRA 5.1 REST docs
@@ -60,13 +97,23 @@ type JIRAUser struct {
 	Self string `json:"self"`
 
 	// The user's system name, e.g. mmcfly
-	Name         string            `json:"name"`
+	Name string `json:"name"`
+
+	// JIRA Cloud identifies users by account id instead of name
+	AccountId string `json:"accountId,omitempty"`
+
+	// JIRA Server's stable user key, which survives renames
+	Key string `json:"key,omitempty"`
+
 	EmailAddress string            `json:"emailAddress"`
 	AvatarUrls   map[string]string `json:"avatarUrls"`
 
 	// Pretty name E.g. Mart McFly
 	DisplayName string `json:"displayName"`
 	Active      bool   `json:"active"`
+
+	// The user's time zone, e.g. Europe/Berlin
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 // Some of the ChangeLogItems may through unmarshal errors but they don't seem
@@ -83,6 +130,10 @@ type ChangleLogItems struct {
 	From       string `json:"from"`
 	FieldType  string `json:"fieldtype"`
 	Field      string `json:"field"`
+
+	// Keys and unknown fields the change was decoded with
+	keys_  map[string]bool
+	extra_ map[string]json.RawMessage
 }
 
 // Describes the JIRAComment object defined in the JIRA 5.1 REST docs
@@ -92,16 +143,17 @@ type JIRAComment struct {
 	Self         string   `json:"self"`
 	Id           string   `json:"id"`
 	Author       JIRAUser `json:"author"`
-	Body         string   `json:"body"`
+	Body         JIRAText `json:"body"`
 	UpdateAuthor JIRAUser `json:"updateAuthor"`
-	Created      string   `json:"created"`
-	Updated      string   `json:"updated"`
+	Created      JIRATime `json:"created"`
+	Updated      JIRATime `json:"updated"`
 }
 
 type IssueFieldData struct {
 	Summary     string            `json:"summary"`
-	Created     string            `json:"created"`
-	Description string            `json:"description"`
+	Created     JIRATime          `json:"created"`
+	Updated     JIRATime          `json:"updated"`
+	Description JIRAText          `json:"description"`
 	Priority    JIRAIssuePriority `json:"priority"`
 	Assignee    JIRAIssueAssignee `json:"assignee"`
 	Labels      []string          `json:"labels"`
@@ -109,16 +161,86 @@ type IssueFieldData struct {
 	Comment     InnerComment      `json:"comment"`
 	IssueType   JIRAIssueType     `json:"issuetype"`
 	Project     JIRAProject       `json:"project"`
+
+	Reporter    JIRAUser `json:"reporter"`
+	Creator     JIRAUser `json:"creator"`
+	Environment JIRAText `json:"environment"`
+
+	Components       []JIRAComponent `json:"components"`
+	FixVersions      []JIRAVersion   `json:"fixVersions"`
+	AffectedVersions []JIRAVersion   `json:"versions"`
+
+	// Resolution is empty while the issue is unresolved
+	Resolution     JIRAResolution `json:"resolution"`
+	ResolutionDate JIRATime       `json:"resolutiondate"`
+	DueDate        JIRATime       `json:"duedate"`
+
+	// Parent is only set for sub-tasks
+	Parent   *JIRAIssue  `json:"parent,omitempty"`
+	Subtasks []JIRAIssue `json:"subtasks"`
+
+	// Time logged and remaining and original estimates in seconds
+	TimeSpent            int `json:"timespent,omitempty"`
+	TimeEstimate         int `json:"timeestimate,omitempty"`
+	TimeOriginalEstimate int `json:"timeoriginalestimate,omitempty"`
+
+	IssueLinks   []JIRALink       `json:"issuelinks"`
+	Attachments  []JIRAAttachment `json:"attachment"`
+	Watches      JIRAWatches      `json:"watches"`
+	TimeTracking JIRATimeTracking `json:"timetracking"`
+
 	// CustomFields is a map of customfield_xxx from your JIRA instance. The key will match whichever
 	// custom fields you have created. The contents obviously depend on what you have created. The value
-	// the raw string value of whatever your field contains.
-	CustomFields map[string]string
+	// the raw string value of whatever your field contains. Use Custom for typed access.
+	CustomFields map[string]string `json:"-"`
+
+	// Raw JSON of each custom field, and the keys and other unknown
+	// fields the fields were decoded with
+	custom_ map[string]json.RawMessage
+	keys_   map[string]bool
+	extra_  map[string]json.RawMessage
+}
+
+// UnmarshalJSON decodes the known fields and collects every
+// customfield_xxx in CustomFields. Unknown fields are kept for MarshalJSON.
+func (f *IssueFieldData) UnmarshalJSON(data []byte) error {
+	type fields IssueFieldData
+	// Like json.Unmarshal, carry on past mistyped fields and report
+	// the first one at the end
+	err := json.Unmarshal(data, (*fields)(f))
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	f.CustomFields = make(map[string]string)
+	f.custom_ = make(map[string]json.RawMessage)
+	f.keys_, f.extra_ = decodeObject(data, issueFieldNames)
+	for k, v := range all {
+		if !strings.HasPrefix(k, "customfield_") {
+			continue
+		}
+		delete(f.extra_, k)
+		f.custom_[k] = compactJSON(v)
+		// Strings are unquoted, anything else is kept as JSON
+		var str string
+		if json.Unmarshal(v, &str) == nil {
+			f.CustomFields[k] = str
+		} else {
+			f.CustomFields[k] = string(v)
+		}
+	}
+	return err
 }
 
 type JIRAIssueAssignee struct {
 	Self        string            `json:"self"`
 	Name        string            `json:"name"`
 	Key         string            `json:"key"`
+	AccountId   string            `json:"accountId,omitempty"`
 	Email       string            `json:"emailAddress"`
 	AvatarUrls  map[string]string `json:"avatarUrls"`
 	DisplayName string            `json:"displayName"`
@@ -132,7 +254,18 @@ type JIRAIssuePriority struct {
 }
 
 type JIRAIssueStatus struct {
-	Name string `json:"name"`
+	Id             string             `json:"id,omitempty"`
+	Name           string             `json:"name"`
+	StatusCategory JIRAStatusCategory `json:"statusCategory"`
+}
+
+// Statuses belong to one of three categories: new (To Do), indeterminate
+// (In Progress) and done (Done)
+type JIRAStatusCategory struct {
+	Id        int    `json:"id,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Name      string `json:"name,omitempty"`
+	ColorName string `json:"colorName,omitempty"`
 }
 
 type JIRAIssueType struct {
@@ -141,7 +274,58 @@ type JIRAIssueType struct {
 	Description string `json:"description"`
 	IconURL     string `json:"iconUrl"`
 	Name        string `json:"name"`
-	subtask     bool   `json:"subtask"`
+	Subtask     bool   `json:"subtask"`
+}
+
+type JIRAComponent struct {
+	Self        string `json:"self"`
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type JIRAResolution struct {
+	Self        string `json:"self"`
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// A link to another issue as found in an issue's fields. Only one of
+// InwardIssue and OutwardIssue is set, with a few of its fields.
+type JIRALink struct {
+	Self         string       `json:"self"`
+	Id           string       `json:"id"`
+	Type         JIRALinkType `json:"type"`
+	InwardIssue  *JIRAIssue   `json:"inwardIssue,omitempty"`
+	OutwardIssue *JIRAIssue   `json:"outwardIssue,omitempty"`
+}
+
+// The kind of a link, e.g. Blocks with outward description "blocks" and
+// inward description "is blocked by"
+type JIRALinkType struct {
+	Self    string `json:"self"`
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Inward  string `json:"inward"`
+	Outward string `json:"outward"`
+}
+
+type JIRAWatches struct {
+	Self       string `json:"self"`
+	WatchCount int    `json:"watchCount"`
+	IsWatching bool   `json:"isWatching"`
+}
+
+// Estimates and time spent, both formatted by JIRA, e.g. 1w 2d, and in
+// seconds
+type JIRATimeTracking struct {
+	OriginalEstimate         string `json:"originalEstimate,omitempty"`
+	RemainingEstimate        string `json:"remainingEstimate,omitempty"`
+	TimeSpent                string `json:"timeSpent,omitempty"`
+	OriginalEstimateSeconds  int    `json:"originalEstimateSeconds,omitempty"`
+	RemainingEstimateSeconds int    `json:"remainingEstimateSeconds,omitempty"`
+	TimeSpentSeconds         int    `json:"timeSpentSeconds,omitempty"`
 }
 
 type InnerComment struct {
@@ -159,6 +343,146 @@ type JIRAProject struct {
 	IconUrl    string            `json:"iconUrl"`
 	Subtask    bool              `json:"subtask"`
 	AvatarUrls map[string]string `json:"avatarUrls"`
+
+	// Only set in project_* events
+	ProjectLead JIRAUser `json:"projectLead"`
+}
+
+// UnmarshalJSON accepts the numeric project ids sent in project_* events
+// as well as the string ids used everywhere else
+func (p *JIRAProject) UnmarshalJSON(data []byte) error {
+	type project JIRAProject
+	aux := struct {
+		*project
+		Id json.RawMessage `json:"id"`
+	}{project: (*project)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	p.Id = flexibleId(aux.Id)
+	return nil
+}
+
+// flexibleId returns the string or number id as a string
+func flexibleId(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// Describes a work log entry as sent in worklog_* events
+//
+// https://docs.atlassian.com/jira/REST/server/#api/2/issue-getIssueWorklog
+type JIRAWorklog struct {
+	Self             string   `json:"self"`
+	Id               string   `json:"id"`
+	IssueId          string   `json:"issueId"`
+	Author           JIRAUser `json:"author"`
+	UpdateAuthor     JIRAUser `json:"updateAuthor"`
+	Comment          JIRAText `json:"comment"`
+	Created          JIRATime `json:"created"`
+	Updated          JIRATime `json:"updated"`
+	Started          JIRATime `json:"started"`
+	TimeSpent        string   `json:"timeSpent"`
+	TimeSpentSeconds int      `json:"timeSpentSeconds"`
+}
+
+// Describes a link between two issues as sent in issuelink_* events.
+// Only the ids of the linked issues are included.
+type JIRAIssueLink struct {
+	Id                 int               `json:"id"`
+	SourceIssueId      int               `json:"sourceIssueId"`
+	DestinationIssueId int               `json:"destinationIssueId"`
+	IssueLinkType      JIRAIssueLinkType `json:"issueLinkType"`
+	SystemLink         bool              `json:"systemLink"`
+}
+
+// The kind of an issue link, e.g. Blocks with outward name "blocks" and
+// inward name "is blocked by"
+type JIRAIssueLinkType struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	OutwardName string `json:"outwardName"`
+	InwardName  string `json:"inwardName"`
+}
+
+// Describes a JIRA Software sprint
+//
+// https://docs.atlassian.com/jira-software/REST/server/#agile/1.0/sprint
+type JIRASprint struct {
+	Id            int    `json:"id"`
+	Self          string `json:"self"`
+	State         string `json:"state"`
+	Name          string `json:"name"`
+	Goal          string `json:"goal"`
+	StartDate     string `json:"startDate"`
+	EndDate       string `json:"endDate"`
+	CompleteDate  string `json:"completeDate"`
+	OriginBoardId int    `json:"originBoardId"`
+}
+
+// Describes a project version
+//
+// https://docs.atlassian.com/jira/REST/server/#api/2/version
+type JIRAVersion struct {
+	Self            string `json:"self"`
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Archived        bool   `json:"archived"`
+	Released        bool   `json:"released"`
+	Overdue         bool   `json:"overdue"`
+	StartDate       string `json:"startDate"`
+	ReleaseDate     string `json:"releaseDate"`
+	UserReleaseDate string `json:"userReleaseDate"`
+	ProjectId       int    `json:"projectId"`
+}
+
+// Describes a JIRA Software board
+//
+// https://docs.atlassian.com/jira-software/REST/server/#agile/1.0/board
+type JIRABoard struct {
+	Id   int    `json:"id"`
+	Self string `json:"self"`
+	Name string `json:"name"`
+
+	// scrum or kanban
+	Type string `json:"type"`
+}
+
+// Describes a file attached to an issue
+//
+// https://docs.atlassian.com/jira/REST/server/#api/2/attachment
+type JIRAAttachment struct {
+	Self      string   `json:"self"`
+	Id        string   `json:"id"`
+	Filename  string   `json:"filename"`
+	Author    JIRAUser `json:"author"`
+	Created   JIRATime `json:"created"`
+	Size      int      `json:"size"`
+	MimeType  string   `json:"mimeType"`
+	Content   string   `json:"content"`
+	Thumbnail string   `json:"thumbnail,omitempty"`
+}
+
+// UnmarshalJSON accepts the numeric attachment ids sent in attachment_*
+// events as well as the string ids returned by the REST API
+func (a *JIRAAttachment) UnmarshalJSON(data []byte) error {
+	type attachment JIRAAttachment
+	aux := struct {
+		*attachment
+		Id json.RawMessage `json:"id"`
+	}{attachment: (*attachment)(a)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	a.Id = flexibleId(aux.Id)
+	return nil
 }
 
 // Returns the 16x16 user Avatar
@@ -182,28 +506,31 @@ func (j *JIRAUser) LargeAvatar() string {
 func Parse(r *http.Request) (JIRAWebevent, error) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		panic(err)
+		return JIRAWebevent{}, err
 	}
+	return ParseBytes(body)
+}
 
+// ParseBytes parses a JIRA webhook payload, e.g. one archived from Raw.
+// Like Parse, the event is returned along with any error unmarshaling
+// oddly formed data.
+func ParseBytes(body []byte) (JIRAWebevent, error) {
 	var event JIRAWebevent
+	var err error
 
 	// This will generate a error unmarshaling some of the data but
 	// is is safe to ignore. We return the error so you at least know
 	// that there is some oddly formed data.
 	err = json.Unmarshal(body, &event)
 
-	event.Issue.Fields.CustomFields = make(map[string]string, 0)
-
-	if len(event.Issue.Id) != 0 {
-		jsonparser.ObjectEach(body, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
-			k := string(key)
-			if strings.HasPrefix(k, "customfield_") {
-				event.Issue.Fields.CustomFields[string(key)] = string(value)
-			}
-			return nil
-		}, "issue", "fields")
+	if event.Issue.Fields.CustomFields == nil {
+		event.Issue.Fields.CustomFields = make(map[string]string, 0)
 	}
 
+	// Payloads expanded with names tell us what the custom fields are
+	DefaultFieldRegistry.AddNames(event.Issue.Names)
+
+	event.Raw = append(json.RawMessage(nil), body...)
 	return event, err
 }
 
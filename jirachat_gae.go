@@ -1,6 +1,7 @@
 // Package jirachat provides a client library for running an App Engine
 // JIRA webhook forwarding service. Supported targets include Hipchat and Slack.
 
+//go:build appengine
 // +build appengine
 
 package jirachat
@@ -12,8 +13,9 @@ import (
 	"appengine/urlfetch"
 )
 
-// In the appengine context, return an http.Client with an appengine context
-// using urlfetch transport
-func getHttpClient(r *http.Request) http.Client {
-	return http.Client{Transport: &urlfetch.Transport{Context: appengine.NewContext(r)}}
+// URLFetchTransport returns App Engine's urlfetch transport for the request
+// being handled. Set it as the Transport of the configs on the legacy App
+// Engine runtime, which can't make outgoing requests otherwise.
+func URLFetchTransport(r *http.Request) http.RoundTripper {
+	return &urlfetch.Transport{Context: appengine.NewContext(r)}
 }
@@ -1,33 +1,61 @@
-package jirachat
+package jirachat_test
 
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/corytodd/jirachat"
 )
 
-func ExampleNewHipService(r *http.Request) {
-	config := HipConfig{
-		Token: "<YOUR-ACCESS-TOKEN>",
-	}
-	svc, err := NewHipService(r, &config)
+func ExampleNewHipService() {
+	http.HandleFunc("/jira", func(w http.ResponseWriter, r *http.Request) {
+		svc, err := jirachat.NewHipService(r, &jirachat.HipConfig{
+			Token:       "<YOUR-ACCESS-TOKEN>",
+			Domain:      "example", // Your JIRA domain, e.g. example.atlassian.net
+			DefaultRoom: "JIRA",
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// JIRA events can be touchy, don't consider parse errors fatal
+		event, err := jirachat.Parse(r)
+		if err != nil {
+			log.Printf("Error parsing JIRA event %v", err)
+		}
+		if _, err := svc.Dispatch(&event); err != nil {
+			log.Printf("HipChat error %v", err)
+		}
+	})
 }
 
-func ExampleNewSlackService(r *http.Request) {
-	svc := jirachat.NewSlackService(r,
-		&jirachat.SlackConfig{
-			ErrChan:    "https://hooks.slack.com/services/<random_webhook_url>",
-			BotName:    "Animus",
-			WebhookUrl: "https://hooks.slack.com/services/<random_webhook_url>",
-			Domain:     "example", // Your JIRA domain, e.g. example.atlassian.net
-		})
+func ExampleNewSlackService() {
+	http.HandleFunc("/jira", func(w http.ResponseWriter, r *http.Request) {
+		svc := jirachat.NewSlackService(r,
+			&jirachat.SlackConfig{
+				ErrChan:    "https://hooks.slack.com/services/<random_webhook_url>",
+				BotName:    "Animus",
+				WebhookUrl: "https://hooks.slack.com/services/<random_webhook_url>",
+				Domain:     "example", // Your JIRA domain, e.g. example.atlassian.net
+			})
+
+		// JIRA events can be touchy, don't consider parse errors fatal
+		event, err := jirachat.Parse(r)
+		if err != nil {
+			log.Printf("Error parsing JIRA event %v", err)
+		}
+		if err := svc.Dispatch(&event); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
 }
 
 func ExampleResponse() {
 
-	resp := &Response{
+	resp := &jirachat.Response{
 		"string": "Hello",
 		"int":    42,
 	}
@@ -0,0 +1,133 @@
+package jirachattest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HipChatRoom is a room known to a HipChatServer
+type HipChatRoom struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name"`
+	Topic string `json:"topic"`
+}
+
+// HipChatServer emulates the HipChat API v2 methods jirachat uses: room
+// notifications, getting rooms, setting their topic and private messages.
+// Rooms are found by id or name, unknown rooms return 404.
+//
+// HipChat API docs: https://www.hipchat.com/docs/apiv2
+type HipChatServer struct {
+	Server
+
+	// Rooms by id. Set them before sending requests.
+	Rooms map[int]*HipChatRoom
+}
+
+// NewHipChatServer starts a fake HipChat accepting the token, or any
+// token when empty, with the given rooms. Close it when done.
+func NewHipChatServer(token string, rooms ...HipChatRoom) *HipChatServer {
+	s := &HipChatServer{Rooms: make(map[int]*HipChatRoom)}
+	for i := range rooms {
+		s.Rooms[rooms[i].Id] = &rooms[i]
+	}
+	s.Token = token
+	s.start(s.handle)
+	return s
+}
+
+// BaseURL returns the API base URL, for HipConfig.BaseURL
+func (s *HipChatServer) BaseURL() string {
+	return s.URL + "/v2/"
+}
+
+// Notifications returns the room notifications received
+func (s *HipChatServer) Notifications() []Request {
+	var notes []Request
+	for _, req := range s.Requests() {
+		if req.Method == "POST" && strings.HasSuffix(req.Path, "/notification") {
+			notes = append(notes, req)
+		}
+	}
+	return notes
+}
+
+// room finds a room by id or name, s.mu must be held
+func (s *HipChatServer) room(idOrName string) *HipChatRoom {
+	if id, err := strconv.Atoi(idOrName); err == nil {
+		return s.Rooms[id]
+	}
+	for _, room := range s.Rooms {
+		if strings.EqualFold(room.Name, idOrName) {
+			return room
+		}
+	}
+	return nil
+}
+
+func (s *HipChatServer) handle(w http.ResponseWriter, req *Request) {
+	if !s.authorized(req) {
+		hipError(w, http.StatusUnauthorized, "Invalid OAuth session")
+		return
+	}
+
+	// room/{id_or_name}[/notification|/topic] or user/{id_or_email}/message
+	parts := strings.Split(strings.TrimPrefix(req.Path, "/v2/"), "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "user" && parts[2] == "message" && req.Method == "POST":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case len(parts) < 2 || parts[0] != "room":
+		hipError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room := s.room(parts[1])
+	if room == nil {
+		hipError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+	action := ""
+	if len(parts) > 2 {
+		action = parts[2]
+	}
+	switch {
+	case action == "" && req.Method == "GET":
+		writeJSON(w, http.StatusOK, room)
+	case action == "notification" && req.Method == "POST":
+		var note struct {
+			Message string `json:"message"`
+		}
+		if err := req.JSON(&note); err != nil || len(note.Message) == 0 {
+			hipError(w, http.StatusBadRequest, "Message is required")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "topic" && req.Method == "PUT":
+		var topic struct {
+			Topic string `json:"topic"`
+		}
+		if err := req.JSON(&topic); err != nil {
+			hipError(w, http.StatusBadRequest, "Invalid topic")
+			return
+		}
+		room.Topic = topic.Topic
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		hipError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// hipError responds with a HipChat error object
+func hipError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"type":    http.StatusText(status),
+		},
+	})
+}
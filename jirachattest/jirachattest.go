@@ -0,0 +1,165 @@
+// Package jirachattest provides in-process fake Slack and HipChat servers
+// for testing code built on jirachat, such as your own Slacker, without
+// the live services.
+//
+// The servers record every request they receive, check the bearer token
+// when one is set and can be told to fail the next requests with an error
+// status, a rate limit or a delay longer than the client's timeout.
+//
+//	slack := jirachattest.NewSlackServer("xoxb-test")
+//	defer slack.Close()
+//	config := &jirachat.SlackConfig{
+//		WebhookUrl: slack.WebhookURL(),
+//		ApiUrl:     slack.ApiURL(),
+//		Token:      "xoxb-test",
+//	}
+//	...
+//	slack.InjectFault(jirachattest.Fault{Status: http.StatusTooManyRequests, RetryAfter: 30})
+//
+// The package does not depend on jirachat so jirachat's own tests can use
+// it too.
+package jirachattest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is a request received by a fake server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+
+	// Values of form encoded requests
+	Form url.Values
+}
+
+// JSON decodes the body of the request into v
+func (r *Request) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Fault makes a fake server fail a request. The server waits for Delay,
+// or until the client gives up, and then responds with Status unless it
+// is zero. Use a Delay longer than the client's timeout to simulate a
+// timeout.
+type Fault struct {
+	// Error status, e.g. http.StatusInternalServerError
+	Status int
+
+	// Seconds sent in the Retry-After header, e.g. with
+	// http.StatusTooManyRequests
+	RetryAfter int
+
+	// Optional response body, defaults to the status text
+	Body string
+
+	Delay time.Duration
+}
+
+// Server is the part common to the fake servers: an httptest.Server which
+// records requests and injects faults
+type Server struct {
+	*httptest.Server
+
+	// Bearer token expected in the Authorization header. Any token is
+	// accepted when empty.
+	Token string
+
+	mu       sync.Mutex
+	requests []Request
+	faults   []Fault
+}
+
+// start serves handle on a new httptest.Server. Requests are recorded
+// and faults injected before handle is called.
+func (s *Server) start(handle func(w http.ResponseWriter, req *Request)) {
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Header: r.Header.Clone(),
+			Body:   body,
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			req.Form, _ = url.ParseQuery(string(body))
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		var fault *Fault
+		if len(s.faults) > 0 {
+			fault = &s.faults[0]
+			s.faults = s.faults[1:]
+		}
+		s.mu.Unlock()
+
+		if fault != nil {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+			if fault.Status != 0 {
+				if fault.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+				}
+				text := fault.Body
+				if len(text) == 0 {
+					text = http.StatusText(fault.Status)
+				}
+				http.Error(w, text, fault.Status)
+				return
+			}
+		}
+		handle(w, &req)
+	}))
+}
+
+// authorized returns true if the request carries the expected token
+func (s *Server) authorized(req *Request) bool {
+	auth := req.Header.Get("Authorization")
+	if len(s.Token) == 0 {
+		return strings.HasPrefix(auth, "Bearer ")
+	}
+	return auth == "Bearer "+s.Token
+}
+
+// InjectFault fails the next requests, one fault per request in order
+func (s *Server) InjectFault(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// Requests returns the requests received so far, including failed ones
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Reset forgets the requests received and the faults not injected yet
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.faults = nil
+}
+
+// writeJSON responds with v encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,147 @@
+package jirachattest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, url, token, contentType, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestSlackServer(t *testing.T) {
+	s := NewSlackServer("xoxb-test")
+	defer s.Close()
+	s.Users["marty@example.com"] = "U024BE7LH"
+
+	tests := []struct {
+		url, token, contentType, body string
+		status                        int
+		want                          string
+	}{
+		{s.WebhookURL(), "", "application/json", `{"text": "hi"}`, 200, "ok"},
+		{s.WebhookURL(), "", "application/json", `{}`, 400, "no_text"},
+		{s.URL + "/services/wrong", "", "application/json", `{"text": "hi"}`, 404, "no_service"},
+		{s.ApiURL() + "chat.postMessage", "", "application/json", `{"channel": "C1"}`, 200, `"error":"not_authed"`},
+		{s.ApiURL() + "chat.postMessage", "wrong", "application/json", `{"channel": "C1"}`, 200, `"error":"invalid_auth"`},
+		{s.ApiURL() + "chat.postMessage", "xoxb-test", "application/json", `{"channel": "C1"}`, 200, `"ts":"1451901600.000001"`},
+		{s.ApiURL() + "chat.update", "xoxb-test", "application/json", `{"channel": "C1", "ts": "1.2"}`, 200, `"ts":"1.2"`},
+		{s.ApiURL() + "users.lookupByEmail", "xoxb-test", "application/x-www-form-urlencoded",
+			url.Values{"email": {"Marty@example.com"}}.Encode(), 200, `"id":"U024BE7LH"`},
+		{s.ApiURL() + "users.lookupByEmail", "xoxb-test", "application/x-www-form-urlencoded",
+			"email=doc%40example.com", 200, `"error":"users_not_found"`},
+	}
+	for _, tt := range tests {
+		resp, body := post(t, tt.url, tt.token, tt.contentType, tt.body)
+		if resp.StatusCode != tt.status || !strings.Contains(body, tt.want) {
+			t.Errorf("%s %s = %d %s, want %d %s", tt.url, tt.body, resp.StatusCode, body, tt.status, tt.want)
+		}
+	}
+
+	if n := len(s.Requests()); n != len(tests) {
+		t.Errorf("recorded %d requests, want %d", n, len(tests))
+	}
+	// Requests to the webhook and the chat methods, accepted or not
+	if msgs := s.Messages(); len(msgs) != 6 {
+		t.Errorf("recorded %d messages, want 6", len(msgs))
+	}
+	s.Reset()
+	if len(s.Requests()) != 0 {
+		t.Error("requests not reset")
+	}
+}
+
+func TestHipChatServer(t *testing.T) {
+	s := NewHipChatServer("secret", HipChatRoom{Id: 42, Name: "Dev"})
+	defer s.Close()
+
+	tests := []struct {
+		path, token, body string
+		status            int
+	}{
+		{"room/Dev/notification", "secret", `{"message": "hi"}`, 204},
+		{"room/42/notification", "secret", `{"message": "hi"}`, 204},
+		{"room/42/notification", "secret", `{}`, 400},
+		{"room/Ops/notification", "secret", `{"message": "hi"}`, 404},
+		{"room/42/notification", "wrong", `{"message": "hi"}`, 401},
+		{"user/marty@example.com/message", "secret", `{"message": "hi"}`, 204},
+	}
+	for _, tt := range tests {
+		resp, body := post(t, s.BaseURL()+tt.path, tt.token, "application/json", tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s = %d %s, want %d", tt.path, resp.StatusCode, body, tt.status)
+		}
+	}
+	if n := len(s.Notifications()); n != 5 {
+		t.Errorf("recorded %d notifications, want 5", n)
+	}
+
+	req, _ := http.NewRequest("PUT", s.BaseURL()+"room/dev/topic", strings.NewReader(`{"topic": "88 mph"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != 204 {
+		t.Fatalf("set topic = %v, %v", resp, err)
+	}
+	resp.Body.Close()
+	req, _ = http.NewRequest("GET", s.BaseURL()+"room/Dev", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var room HipChatRoom
+	if err := json.NewDecoder(resp.Body).Decode(&room); err != nil || room.Id != 42 || room.Topic != "88 mph" {
+		t.Errorf("room = %+v, %v", room, err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := NewSlackServer("")
+	defer s.Close()
+	s.InjectFault(
+		Fault{Status: http.StatusTooManyRequests, RetryAfter: 30},
+		Fault{Status: http.StatusInternalServerError, Body: "rollup_error"},
+		Fault{Delay: time.Second},
+	)
+
+	resp, _ := post(t, s.WebhookURL(), "", "application/json", `{"text": "hi"}`)
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("rate limit = %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	resp, body := post(t, s.WebhookURL(), "", "application/json", `{"text": "hi"}`)
+	if resp.StatusCode != 500 || !strings.Contains(body, "rollup_error") {
+		t.Errorf("server error = %d %s", resp.StatusCode, body)
+	}
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := client.Post(s.WebhookURL(), "application/json", strings.NewReader(`{"text": "hi"}`)); err == nil {
+		t.Error("delay did not time out")
+	}
+
+	// Faults are used up
+	resp, body = post(t, s.WebhookURL(), "", "application/json", `{"text": "hi"}`)
+	if resp.StatusCode != 200 || body != "ok" {
+		t.Errorf("after faults = %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,154 @@
+package jirachattest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Path of the incoming webhook served by SlackServer
+const slackWebhookPath = "/services/T00000000/B00000000/XXXXXXXXXXXXXXXXXXXXXXXX"
+
+// SlackServer emulates a Slack incoming webhook and the Web API methods
+// jirachat uses: chat.postMessage, chat.update, chat.unfurl and
+// users.lookupByEmail.
+//
+// Slack API docs: https://api.slack.com/web
+type SlackServer struct {
+	Server
+
+	// Slack member ids returned by users.lookupByEmail, by lower case
+	// email. Set them before sending requests.
+	Users map[string]string
+
+	tsMu sync.Mutex
+	ts   int
+}
+
+// NewSlackServer starts a fake Slack accepting the bot token, or any
+// token when empty. Close it when done.
+func NewSlackServer(token string) *SlackServer {
+	s := &SlackServer{Users: make(map[string]string)}
+	s.Token = token
+	s.start(s.handle)
+	return s
+}
+
+// WebhookURL returns the URL of the incoming webhook, for
+// SlackConfig.WebhookUrl
+func (s *SlackServer) WebhookURL() string {
+	return s.URL + slackWebhookPath
+}
+
+// ApiURL returns the Web API base URL, for SlackConfig.ApiUrl
+func (s *SlackServer) ApiURL() string {
+	return s.URL + "/api/"
+}
+
+// Messages returns the requests received posting or updating messages,
+// through the webhook or the Web API
+func (s *SlackServer) Messages() []Request {
+	var msgs []Request
+	for _, req := range s.Requests() {
+		switch req.Path {
+		case slackWebhookPath, "/api/chat.postMessage", "/api/chat.update":
+			msgs = append(msgs, req)
+		}
+	}
+	return msgs
+}
+
+// nextTs returns a new message timestamp
+func (s *SlackServer) nextTs() string {
+	s.tsMu.Lock()
+	defer s.tsMu.Unlock()
+	s.ts++
+	return fmt.Sprintf("1451901600.%06d", s.ts)
+}
+
+func (s *SlackServer) handle(w http.ResponseWriter, req *Request) {
+	if req.Path == slackWebhookPath {
+		s.webhook(w, req)
+		return
+	}
+	if !strings.HasPrefix(req.Path, "/api/") {
+		http.Error(w, "no_service", http.StatusNotFound)
+		return
+	}
+
+	// The Web API reports errors with ok false and status 200
+	if len(req.Header.Get("Authorization")) == 0 {
+		writeJSON(w, http.StatusOK, slackError("not_authed"))
+		return
+	}
+	if !s.authorized(req) {
+		writeJSON(w, http.StatusOK, slackError("invalid_auth"))
+		return
+	}
+
+	var body struct {
+		Channel string `json:"channel"`
+		Ts      string `json:"ts"`
+		Text    string `json:"text"`
+	}
+	method := strings.TrimPrefix(req.Path, "/api/")
+	switch method {
+	case "chat.postMessage", "chat.update":
+		if err := req.JSON(&body); err != nil {
+			writeJSON(w, http.StatusOK, slackError("invalid_json"))
+			return
+		}
+		if len(body.Channel) == 0 {
+			writeJSON(w, http.StatusOK, slackError("channel_not_found"))
+			return
+		}
+		ts := body.Ts
+		if method == "chat.postMessage" {
+			ts = s.nextTs()
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ok": true, "channel": body.Channel, "ts": ts,
+		})
+	case "chat.unfurl":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	case "users.lookupByEmail":
+		email := strings.ToLower(req.Form.Get("email"))
+		id, ok := s.Users[email]
+		if !ok {
+			writeJSON(w, http.StatusOK, slackError("users_not_found"))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ok": true, "user": map[string]string{"id": id},
+		})
+	default:
+		writeJSON(w, http.StatusOK, slackError("unknown_method"))
+	}
+}
+
+// webhook accepts messages with some text or attachments like Slack's
+// incoming webhooks do
+func (s *SlackServer) webhook(w http.ResponseWriter, req *Request) {
+	if req.Method != "POST" {
+		http.Error(w, "invalid_method", http.StatusMethodNotAllowed)
+		return
+	}
+	var msg struct {
+		Text        string        `json:"text"`
+		Attachments []interface{} `json:"attachments"`
+	}
+	if err := req.JSON(&msg); err != nil {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+	if len(msg.Text) == 0 && len(msg.Attachments) == 0 {
+		http.Error(w, "no_text", http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func slackError(code string) map[string]interface{} {
+	return map[string]interface{}{"ok": false, "error": code}
+}
@@ -0,0 +1,580 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Configuration used by JIRAClient to call the JIRA REST API
+type JIRAConfig struct {
+	// JIRA domain name, e.g. example for example.atlassian.net
+	Domain string
+
+	// Optional base URL for JIRA Server instances, e.g.
+	// https://jira.example.com/. Defaults to https://<Domain>.atlassian.net/
+	BaseUrl string
+
+	// Set for JIRA Server and Data Center, which identify users by name
+	// rather than by the account ids of JIRA Cloud
+	Server bool
+
+	// JIRA user name or email and the password or API token used for
+	// basic authentication
+	Username string
+	Token    string
+
+	// OAuth 2.0 access token or JIRA Server personal access token, sent
+	// as a Bearer token instead of basic authentication
+	AccessToken string
+
+	// Optional hook to authorize requests with any other scheme, e.g.
+	// OAuth 1.0a request signing. Called after the request is built.
+	Authorize func(req *http.Request) error
+
+	// How long fetched issues, comments and users are cached.
+	// Defaults to one minute.
+	CacheTTL time.Duration
+
+	// Optional HTTP client used for every request, e.g. one with a proxy,
+	// client certificates or tracing. Takes precedence over Transport.
+	Client *http.Client
+
+	// Optional transport used with a default client when Client is not
+	// set, e.g. URLFetchTransport on the legacy App Engine runtime. With
+	// neither set, as on App Engine's second generation runtimes, net/http's
+	// default transport is used.
+	Transport http.RoundTripper
+
+	baseURL_ *url.URL
+	client_  *http.Client
+	cache_   *jiraCache
+}
+
+// Default time fetched JIRA resources are cached
+const defaultJIRACacheTTL = time.Minute
+
+// jiraCache holds recently fetched JIRA resources. It lives on the
+// JIRAConfig so it survives across the per-request JIRAClient instances.
+type jiraCache struct {
+	mu      sync.Mutex
+	entries map[string]jiraCacheEntry
+}
+
+type jiraCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func (c *jiraCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Most resources kept by a jiraCache
+const maxJIRACacheEntries = 1000
+
+// put caches the value for ttl. A full cache first drops the expired
+// entries and, if that is not enough, whichever entries come first.
+func (c *jiraCache) put(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxJIRACacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < maxJIRACacheEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = jiraCacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+// JIRAClient gives access to the parts of the JIRA REST API used to act
+// on issues from chat.
+type JIRAClient struct {
+	Config *JIRAConfig
+}
+
+// JIRATransition is a workflow transition available on an issue
+type JIRATransition struct {
+	Id   string          `json:"id"`
+	Name string          `json:"name"`
+	To   JIRAIssueStatus `json:"to"`
+}
+
+var ErrNoTransition = errors.New("no matching JIRA transition")
+
+// Guards the state created lazily on JIRAConfigs and shared by their
+// copies
+var jiraConfigMu sync.Mutex
+
+// Create a new JIRA REST client with the given config. The client works on
+// a copy of the config, so handlers can create one per request from a
+// config they share.
+func NewJIRAClient(r *http.Request, config *JIRAConfig) (*JIRAClient, error) {
+	if err := config.IsValid(); err != nil {
+		return nil, err
+	}
+
+	baseUrl, err := url.Parse(config.siteURL())
+	if err != nil {
+		return nil, err
+	}
+
+	jiraConfigMu.Lock()
+	if config.cache_ == nil {
+		config.cache_ = &jiraCache{entries: make(map[string]jiraCacheEntry)}
+	}
+	c := *config
+	jiraConfigMu.Unlock()
+
+	c.client_ = newHttpClient(c.Client, c.Transport)
+	c.baseURL_ = baseUrl
+	return &JIRAClient{Config: &c}, nil
+}
+
+// siteURL returns the base URL of the JIRA instance with a trailing slash
+func (c *JIRAConfig) siteURL() string {
+	base := c.BaseUrl
+	if len(base) == 0 {
+		base = fmt.Sprintf("https://%s.atlassian.net/", c.Domain)
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base
+}
+
+// Returns an error if the configuration is missing required values
+func (c *JIRAConfig) IsValid() error {
+	if len(c.Domain) == 0 && len(c.BaseUrl) == 0 {
+		return errors.New("Invalid JIRA domain")
+	}
+	return nil
+}
+
+// NewRequest creates a JIRA API request. Relative URLs should always be
+// specified without a preceding slash, e.g. rest/api/2/issue/JIRA-100
+func (c *JIRAConfig) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
+	rel, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.baseURL_.ResolveReference(rel)
+
+	buf := new(bytes.Buffer)
+	if body != nil {
+		err := json.NewEncoder(buf).Encode(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, u.String(), buf)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(c.AccessToken) > 0:
+		req.Header.Add("Authorization", "Bearer "+c.AccessToken)
+	case len(c.Username) > 0:
+		req.SetBasicAuth(c.Username, c.Token)
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+
+	if c.Authorize != nil {
+		if err := c.Authorize(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// Do performs the request, the json received in the response is decoded
+// and stored in the value pointed by v.
+func (c *JIRAConfig) Do(req *http.Request, v interface{}) (*http.Response, error) {
+	resp, err := c.client_.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return resp, fmt.Errorf("JIRA returns status %d", c)
+	}
+
+	if v != nil {
+		if w, ok := v.(io.Writer); ok {
+			io.Copy(w, resp.Body)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(v)
+		}
+	}
+	return resp, err
+}
+
+// AssignIssue assigns the issue to the user with the given name on JIRA
+// Server or account id on JIRA Cloud, see JIRAConfig.Server. An empty
+// user unassigns the issue.
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-assign
+func (j *JIRAClient) AssignIssue(key, nameOrAccountId string) error {
+	param := "accountId"
+	if j.Config.Server {
+		param = "name"
+	}
+	body := map[string]interface{}{param: nil}
+	if len(nameOrAccountId) > 0 {
+		body[param] = nameOrAccountId
+	}
+	req, err := j.Config.NewRequest("PUT",
+		fmt.Sprintf("rest/api/2/issue/%s/assignee", url.PathEscape(key)), body)
+	if err != nil {
+		return err
+	}
+	_, err = j.Config.Do(req, nil)
+	return err
+}
+
+// Transitions returns the transitions currently available on the issue
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-getTransitions
+func (j *JIRAClient) Transitions(key string) ([]JIRATransition, error) {
+	req, err := j.Config.NewRequest("GET",
+		fmt.Sprintf("rest/api/2/issue/%s/transitions", url.PathEscape(key)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Transitions []JIRATransition `json:"transitions"`
+	}
+	if _, err := j.Config.Do(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Transitions, nil
+}
+
+// TransitionIssue moves the issue through the transition matching name.
+// Both the transition name, e.g. "Start Progress", and the name of the
+// status it leads to, e.g. "In Progress", are accepted.
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-doTransition
+func (j *JIRAClient) TransitionIssue(key, name string) error {
+	transitions, err := j.Transitions(key)
+	if err != nil {
+		return err
+	}
+
+	id := ""
+	for _, t := range transitions {
+		if strings.EqualFold(t.Name, name) || strings.EqualFold(t.To.Name, name) {
+			id = t.Id
+			break
+		}
+	}
+	if len(id) == 0 {
+		return fmt.Errorf("%w %q for %s", ErrNoTransition, name, key)
+	}
+
+	body := map[string]interface{}{
+		"transition": map[string]string{"id": id},
+	}
+	req, err := j.Config.NewRequest("POST",
+		fmt.Sprintf("rest/api/2/issue/%s/transitions", url.PathEscape(key)), body)
+	if err != nil {
+		return err
+	}
+	_, err = j.Config.Do(req, nil)
+	return err
+}
+
+// AddComment adds a comment to the issue
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-addComment
+func (j *JIRAClient) AddComment(key, body string) (*JIRAComment, error) {
+	req, err := j.Config.NewRequest("POST",
+		fmt.Sprintf("rest/api/2/issue/%s/comment", url.PathEscape(key)),
+		map[string]string{"body": body})
+	if err != nil {
+		return nil, err
+	}
+
+	comment := new(JIRAComment)
+	if _, err := j.Config.Do(req, comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// get fetches the JIRA resource at urlStr into v, consulting the cache
+// first. v must be a pointer to a struct, the cache stores a copy.
+func (j *JIRAClient) get(urlStr string, v interface{}) error {
+	cache := j.Config.cache_
+	if cached, ok := cache.get(urlStr); ok {
+		return json.Unmarshal(cached.([]byte), v)
+	}
+
+	req, err := j.Config.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if _, err := j.Config.Do(req, buf); err != nil {
+		return err
+	}
+
+	ttl := j.Config.CacheTTL
+	if ttl == 0 {
+		ttl = defaultJIRACacheTTL
+	}
+	cache.put(urlStr, buf.Bytes(), ttl)
+	return json.Unmarshal(buf.Bytes(), v)
+}
+
+// GetIssue returns the issue with all of its fields. The names of the
+// custom fields are added to DefaultFieldRegistry.
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-getIssue
+func (j *JIRAClient) GetIssue(key string) (*JIRAIssue, error) {
+	issue := new(JIRAIssue)
+	err := j.get(fmt.Sprintf("rest/api/2/issue/%s?expand=names", url.PathEscape(key)), issue)
+	if err != nil {
+		return nil, err
+	}
+	DefaultFieldRegistry.AddNames(issue.Names)
+	return issue, nil
+}
+
+// GetComment returns a single comment of the issue
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-getComment
+func (j *JIRAClient) GetComment(key, id string) (*JIRAComment, error) {
+	comment := new(JIRAComment)
+	err := j.get(fmt.Sprintf("rest/api/2/issue/%s/comment/%s",
+		url.PathEscape(key), url.PathEscape(id)), comment)
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// GetWatchers returns the users watching the issue
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/issue-getIssueWatchers
+func (j *JIRAClient) GetWatchers(key string) ([]JIRAUser, error) {
+	var watchers struct {
+		Watchers []JIRAUser `json:"watchers"`
+	}
+	err := j.get(fmt.Sprintf("rest/api/2/issue/%s/watchers", url.PathEscape(key)), &watchers)
+	if err != nil {
+		return nil, err
+	}
+	return watchers.Watchers, nil
+}
+
+// GetUser returns the user with the given name on JIRA Server or account
+// id on JIRA Cloud, see JIRAConfig.Server
+func (j *JIRAClient) GetUser(nameOrAccountId string) (*JIRAUser, error) {
+	if j.Config.Server {
+		return j.GetUserByName(nameOrAccountId)
+	}
+	return j.GetUserByAccountId(nameOrAccountId)
+}
+
+// GetUserByName returns the JIRA Server user with the given name
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/user-getUser
+func (j *JIRAClient) GetUserByName(name string) (*JIRAUser, error) {
+	return j.getUser("username", name)
+}
+
+// GetUserByAccountId returns the JIRA Cloud user with the given account id
+//
+// JIRA API docs: https://developer.atlassian.com/cloud/jira/platform/rest/v2/api-group-users/#api-rest-api-2-user-get
+func (j *JIRAClient) GetUserByAccountId(accountId string) (*JIRAUser, error) {
+	return j.getUser("accountId", accountId)
+}
+
+// FindUsers returns the users whose name, display name or email address
+// match the query
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/user-findUsers
+func (j *JIRAClient) FindUsers(query string) ([]JIRAUser, error) {
+	param := "query"
+	if j.Config.Server {
+		param = "username"
+	}
+	var users []JIRAUser
+	err := j.get(fmt.Sprintf("rest/api/2/user/search?%s=%s", param, url.QueryEscape(query)), &users)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (j *JIRAClient) getUser(param, value string) (*JIRAUser, error) {
+	user := new(JIRAUser)
+	err := j.get(fmt.Sprintf("rest/api/2/user?%s=%s", param, url.QueryEscape(value)), user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetProject returns the project with the given id or key
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/project-getProject
+func (j *JIRAClient) GetProject(idOrKey string) (*JIRAProject, error) {
+	project := new(JIRAProject)
+	err := j.get(fmt.Sprintf("rest/api/2/project/%s", url.PathEscape(idOrKey)), project)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// Fields fetched for issues listed in bulk
+const issueListFields = "summary,status,issuetype,priority,assignee,project,resolution"
+
+// Largest number of issues fetched by SearchIssues and SprintIssues
+const maxIssueList = 1000
+
+// issuePage is a page of issues returned by the search and agile APIs
+type issuePage struct {
+	StartAt    int         `json:"startAt"`
+	MaxResults int         `json:"maxResults"`
+	Total      int         `json:"total"`
+	Issues     []JIRAIssue `json:"issues"`
+}
+
+// issueList fetches every page of the issue list at urlStr, which must
+// already have a query string
+func (j *JIRAClient) issueList(urlStr string) ([]JIRAIssue, error) {
+	var issues []JIRAIssue
+	for len(issues) < maxIssueList {
+		var page issuePage
+		err := j.get(fmt.Sprintf("%s&fields=%s&startAt=%d&maxResults=100",
+			urlStr, issueListFields, len(issues)), &page)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page.Issues...)
+		if len(page.Issues) == 0 || len(issues) >= page.Total {
+			break
+		}
+	}
+	return issues, nil
+}
+
+// SearchIssues returns the issues matching the JQL query with their
+// summary, status, type, priority, assignee, project and resolution
+//
+// JIRA API docs: https://docs.atlassian.com/jira/REST/server/#api/2/search-search
+func (j *JIRAClient) SearchIssues(jql string) ([]JIRAIssue, error) {
+	return j.issueList("rest/api/2/search?jql=" + url.QueryEscape(jql))
+}
+
+// SprintIssues returns the issues in the sprint with the same fields as
+// SearchIssues
+//
+// JIRA API docs: https://docs.atlassian.com/jira-software/REST/server/#agile/1.0/sprint-getIssuesForSprint
+func (j *JIRAClient) SprintIssues(sprintId int) ([]JIRAIssue, error) {
+	return j.issueList(fmt.Sprintf("rest/agile/1.0/sprint/%d/issue?validateQuery=false", sprintId))
+}
+
+// Enrich fetches whatever the webhook payload is missing so renderers
+// always have the issue summary, assignee, priority and status, the
+// comment body and the user's display name. Webhook payloads vary between
+// JIRA versions and event types, and comment events in particular often
+// carry a bare issue.
+func (j *JIRAClient) Enrich(event *JIRAWebevent) error {
+	// Work log events only carry the issue id
+	if len(event.Issue.Key) == 0 && len(event.Worklog.IssueId) > 0 {
+		issue, err := j.GetIssue(event.Worklog.IssueId)
+		if err != nil {
+			return err
+		}
+		event.Issue = *issue
+	}
+
+	fields := &event.Issue.Fields
+	if len(event.Issue.Key) > 0 && (len(fields.Summary) == 0 ||
+		len(fields.Status.Name) == 0 || len(fields.Priority.Id) == 0) {
+		issue, err := j.GetIssue(event.Issue.Key)
+		if err != nil {
+			return err
+		}
+		custom, raw := fields.CustomFields, fields.custom_
+		if len(fields.Summary) == 0 {
+			event.Issue.Fields = issue.Fields
+		} else {
+			if len(fields.Status.Name) == 0 {
+				fields.Status = issue.Fields.Status
+			}
+			if len(fields.Priority.Id) == 0 {
+				fields.Priority = issue.Fields.Priority
+			}
+			if len(fields.Assignee.Name) == 0 {
+				fields.Assignee = issue.Fields.Assignee
+			}
+		}
+		if len(custom) > 0 {
+			fields.CustomFields, fields.custom_ = custom, raw
+		}
+		if len(event.Issue.Id) == 0 {
+			event.Issue.Id = issue.Id
+		}
+	}
+
+	if len(event.Comment.Id) > 0 && len(event.Comment.Body) == 0 {
+		comment, err := j.GetComment(event.Issue.Key, event.Comment.Id)
+		if err != nil {
+			return err
+		}
+		event.Comment = *comment
+	}
+
+	user := &event.User
+	if len(user.DisplayName) == 0 {
+		var fetched *JIRAUser
+		var err error
+		switch {
+		case len(user.AccountId) > 0:
+			fetched, err = j.GetUserByAccountId(user.AccountId)
+		case len(user.Name) > 0:
+			fetched, err = j.GetUserByName(user.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if fetched != nil {
+			*user = *fetched
+		}
+	}
+	return nil
+}
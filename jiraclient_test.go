@@ -0,0 +1,142 @@
+package jirachat
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newRESTServer serves canned JIRA REST responses by request URI and
+// records the URIs requested
+func newRESTServer(t *testing.T, responses map[string]string) (*httptest.Server, *[]string) {
+	var uris []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uris = append(uris, r.URL.RequestURI())
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s, &uris
+}
+
+func TestGetUser(t *testing.T) {
+	s, uris := newRESTServer(t, map[string]string{
+		"/rest/api/2/user?username=mmcfly":    `{"name": "mmcfly", "displayName": "Marty McFly"}`,
+		"/rest/api/2/user?accountId=5b10a284": `{"accountId": "5b10a284", "displayName": "Marty McFly"}`,
+	})
+
+	tests := []struct {
+		server bool
+		id     string
+	}{
+		{true, "mmcfly"},
+		{false, "5b10a284"},
+	}
+	for _, tt := range tests {
+		client, err := NewJIRAClient(nil, &JIRAConfig{BaseUrl: s.URL, Server: tt.server})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := client.GetUser(tt.id)
+		if err != nil || user.DisplayName != "Marty McFly" {
+			t.Errorf("GetUser(%q) with Server %v = %+v, %v", tt.id, tt.server, user, err)
+		}
+	}
+
+	// Names can be looked up explicitly whatever the deployment
+	client, _ := NewJIRAClient(nil, &JIRAConfig{BaseUrl: s.URL})
+	if _, err := client.GetUserByName("mmcfly"); err != nil {
+		t.Error(err)
+	}
+	if len(*uris) != 3 {
+		t.Errorf("requests = %v", *uris)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	s, uris := newRESTServer(t, map[string]string{
+		"/rest/api/2/issue/PROJ-1?expand=names": `{"id": "10001", "key": "PROJ-1", "fields": {
+			"summary": "Fix the flux capacitor",
+			"status": {"name": "Open"},
+			"priority": {"id": "2", "name": "High"},
+			"assignee": {"name": "dbrown", "displayName": "Emmett Brown"}}}`,
+		"/rest/api/2/issue/PROJ-1/comment/100": `{"id": "100", "body": "Great Scott!"}`,
+		"/rest/api/2/user?accountId=5b10a284":  `{"accountId": "5b10a284", "displayName": "Marty McFly"}`,
+		"/rest/api/2/user?username=mmcfly":     `{"name": "mmcfly", "displayName": "Marty McFly"}`,
+		"/rest/api/2/issue/10002?expand=names": `{"id": "10002", "key": "PROJ-2", "fields": {
+			"summary": "Find plutonium", "status": {"name": "Open"}, "priority": {"id": "3"}}}`,
+	})
+	client, err := NewJIRAClient(nil, &JIRAConfig{BaseUrl: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Cloud comment event with a bare issue
+	event := parseString(t, `{"webhookEvent": "comment_created",
+		"user": {"accountId": "5b10a284"},
+		"comment": {"id": "100"},
+		"issue": {"key": "PROJ-1"}}`)
+	if err := client.Enrich(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Issue.Id != "10001" || event.Issue.Fields.Summary != "Fix the flux capacitor" ||
+		event.Issue.Fields.Assignee.DisplayName != "Emmett Brown" ||
+		event.Comment.Body != "Great Scott!" || event.User.DisplayName != "Marty McFly" {
+		t.Errorf("enriched = %+v", event)
+	}
+
+	// A Server worklog event only carrying the issue id
+	event = parseString(t, `{"webhookEvent": "worklog_created",
+		"user": {"name": "mmcfly"},
+		"worklog": {"id": "1", "issueId": "10002"}}`)
+	if err := client.Enrich(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Issue.Key != "PROJ-2" || event.User.DisplayName != "Marty McFly" {
+		t.Errorf("enriched = %+v", event)
+	}
+
+	// Complete payloads are left alone and fetched resources are cached
+	n := len(*uris)
+	event = parseString(t, dryRunPayload)
+	if err := client.Enrich(&event); err != nil {
+		t.Fatal(err)
+	}
+	if len(*uris) != n {
+		t.Errorf("complete payload fetched %v", (*uris)[n:])
+	}
+
+	event = parseString(t, `{"webhookEvent": "comment_created",
+		"comment": {"id": "404"}, "issue": {"key": "PROJ-1"}}`)
+	if err := client.Enrich(&event); err == nil {
+		t.Error("missing comment not reported")
+	}
+}
+
+func TestJIRACacheBounded(t *testing.T) {
+	c := &jiraCache{entries: make(map[string]jiraCacheEntry)}
+	for i := 0; i < maxJIRACacheEntries; i++ {
+		c.put(fmt.Sprintf("expired/%d", i), i, -time.Second)
+	}
+	c.put("fresh", "value", time.Minute)
+	if len(c.entries) != 1 {
+		t.Errorf("%d entries after sweeping expired ones", len(c.entries))
+	}
+
+	for i := 0; i < 2*maxJIRACacheEntries; i++ {
+		c.put(fmt.Sprintf("live/%d", i), i, time.Minute)
+	}
+	if len(c.entries) > maxJIRACacheEntries {
+		t.Errorf("%d entries, want at most %d", len(c.entries), maxJIRACacheEntries)
+	}
+	if v, ok := c.get(fmt.Sprintf("live/%d", 2*maxJIRACacheEntries-1)); !ok || v != 2*maxJIRACacheEntries-1 {
+		t.Errorf("latest entry = %v, %v", v, ok)
+	}
+}
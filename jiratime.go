@@ -0,0 +1,190 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Layouts of the dates and times sent by JIRA
+const (
+	jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+	jiraDateLayout = "2006-01-02"
+)
+
+// JIRATime is a date or date time sent by JIRA, e.g. 2016-01-04 or
+// 2016-01-04T10:00:00.000+0000. Milliseconds since the epoch are accepted
+// too. The zero time stands for a missing or null value.
+type JIRATime struct {
+	time.Time
+
+	// Set when the value was a date without a time
+	date bool
+
+	// Set when the value was milliseconds since the epoch
+	epoch bool
+}
+
+// UnmarshalJSON accepts JIRA's date and date time formats and epoch
+// milliseconds
+func (t *JIRATime) UnmarshalJSON(data []byte) error {
+	*t = JIRATime{}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if ms, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+		t.Time, t.epoch = time.Unix(0, ms*int64(time.Millisecond)), true
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	for _, layout := range []string{jiraTimeLayout, time.RFC3339Nano} {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	parsed, err := time.Parse(jiraDateLayout, s)
+	if err != nil {
+		return fmt.Errorf("Invalid JIRA time %q", s)
+	}
+	t.Time, t.date = parsed, true
+	return nil
+}
+
+// MarshalJSON writes the time in the format JIRA sent it in
+func (t JIRATime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	if t.epoch {
+		return []byte(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)), nil
+	}
+	return json.Marshal(t.String())
+}
+
+// IsDate returns true if the value is a date without a time
+func (t JIRATime) IsDate() bool {
+	return t.date
+}
+
+// String formats the time the way JIRA does, dates without a time
+func (t JIRATime) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	if t.date {
+		return t.Format(jiraDateLayout)
+	}
+	return t.Format(jiraTimeLayout)
+}
+
+// Current time used by Relative, replaced by tests
+var clock = time.Now
+
+// Relative describes the time relative to now, e.g. 3h ago or in 2d.
+// Times more than a week away are formatted as a date.
+func (t JIRATime) Relative() string {
+	return t.RelativeTo(clock())
+}
+
+// RelativeTo describes the time relative to now, see Relative
+func (t JIRATime) RelativeTo(now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := now.Sub(t.Time)
+	suffix := " ago"
+	if d < 0 {
+		d, suffix = -d, ""
+	}
+
+	var n int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "m"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "h"
+	case d < 7*24*time.Hour:
+		n, unit = int(d/(24*time.Hour)), "d"
+	default:
+		if t.Year() == now.Year() {
+			return t.Format("Jan 2")
+		}
+		return t.Format("Jan 2, 2006")
+	}
+	if len(suffix) == 0 {
+		return fmt.Sprintf("in %d%s", n, unit)
+	}
+	return fmt.Sprintf("%d%s%s", n, unit, suffix)
+}
+
+// age returns how long ago the event happened for fallback texts, e.g.
+// " (3h ago)", or nothing for events which just happened. Only replayed or
+// delayed deliveries show it.
+func (e *JIRAWebevent) age() string {
+	if e.Timestamp.IsZero() {
+		return ""
+	}
+	rel := e.Timestamp.Relative()
+	if rel == "just now" {
+		return ""
+	}
+	return " (" + rel + ")"
+}
+
+// Loaded time zones by name
+var locations sync.Map
+
+// location returns the named IANA time zone, e.g. Europe/Berlin, or UTC if
+// it is unknown
+func location(name string) *time.Location {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = time.UTC
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// FormatIn formats the time in the named time zone, e.g. the Timezone of
+// a JIRAIssueAssignee. Dates without a time are formatted as dates.
+func (t JIRATime) FormatIn(timezone string) string {
+	if t.IsZero() {
+		return ""
+	}
+	if t.date {
+		return t.Format("Mon Jan 2, 2006")
+	}
+	return t.In(location(timezone)).Format("Mon Jan 2, 15:04 MST")
+}
+
+// Format of the Slack date tokens made by SlackDate
+const SlackDateFormat = "{date_short_pretty} at {time}"
+
+// SlackDate returns a Slack date token which Slack shows in each reader's
+// own time zone, e.g. <!date^1451901600^{date_short_pretty} at {time}|...>.
+// Clients that can't render it show the time in UTC.
+//
+// Slack API docs: https://api.slack.com/reference/surfaces/formatting#date-formatting
+func (t JIRATime) SlackDate(format string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("<!date^%d^%s|%s>", t.Unix(), format, t.FormatIn("UTC"))
+}
@@ -0,0 +1,58 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJIRATime(t *testing.T) {
+	var event struct {
+		Timestamp JIRATime `json:"timestamp"`
+		Created   JIRATime `json:"created"`
+	}
+	data := `{"timestamp":1451901600000,"created":"2016-01-04T10:00:00.000+0000"}`
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatal(err)
+	}
+	if !event.Timestamp.Equal(event.Created.Time) {
+		t.Errorf("timestamp %v != created %v", event.Timestamp, event.Created)
+	}
+
+	out, _ := json.Marshal(event)
+	if string(out) != data {
+		t.Errorf("round trip\ngot  %s\nwant %s", out, data)
+	}
+
+	now := event.Created.Add(3*time.Hour + 20*time.Minute)
+	if got := event.Created.RelativeTo(now); got != "3h ago" {
+		t.Errorf("relative = %q", got)
+	}
+	if got := event.Created.RelativeTo(event.Created.Add(-2 * 24 * time.Hour)); got != "in 2d" {
+		t.Errorf("relative = %q", got)
+	}
+	if got := event.Created.FormatIn("America/Los_Angeles"); got != "Mon Jan 4, 02:00 PST" {
+		t.Errorf("FormatIn = %q", got)
+	}
+	want := "<!date^1451901600^{date_short_pretty} at {time}|Mon Jan 4, 10:00 UTC>"
+	if got := event.Created.SlackDate(SlackDateFormat); got != want {
+		t.Errorf("SlackDate = %q", got)
+	}
+}
+
+func TestEventAge(t *testing.T) {
+	event := parseString(t, `{"webhookEvent": "jira:issue_created", "timestamp": 1451901600000}`)
+	defer func() { clock = time.Now }()
+
+	clock = func() time.Time { return event.Timestamp.Add(20 * time.Second) }
+	if got := event.age(); got != "" {
+		t.Errorf("age of a new event = %q", got)
+	}
+	clock = func() time.Time { return event.Timestamp.Add(3 * time.Hour) }
+	if got := event.age(); got != " (3h ago)" {
+		t.Errorf("age = %q", got)
+	}
+	if got := (&JIRAWebevent{}).age(); got != "" {
+		t.Errorf("age without timestamp = %q", got)
+	}
+}
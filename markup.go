@@ -0,0 +1,1050 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// JIRAText is a rich text field such as a comment body or an issue
+// description. JIRA Server and the v2 REST API send wiki markup strings,
+// JIRA Cloud's v3 API sends Atlassian Document Format (ADF) objects which
+// are kept as their raw JSON. Use a MarkupConverter to render either.
+type JIRAText string
+
+func (t *JIRAText) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*t = JIRAText(s)
+		return nil
+	}
+	if string(data) == "null" {
+		*t = ""
+		return nil
+	}
+	*t = JIRAText(data)
+	return nil
+}
+
+func (t JIRAText) MarshalJSON() ([]byte, error) {
+	if t.IsADF() {
+		return []byte(t), nil
+	}
+	return json.Marshal(string(t))
+}
+
+// IsADF returns true if the text is an Atlassian Document Format document
+func (t JIRAText) IsADF() bool {
+	_, ok := parseADF(string(t))
+	return ok
+}
+
+// Mrkdwn renders the text as Slack mrkdwn
+func (t JIRAText) Mrkdwn() string { return defaultConverter.Mrkdwn(string(t)) }
+
+// HTML renders the text as HipChat flavored HTML
+func (t JIRAText) HTML() string { return defaultConverter.HTML(string(t)) }
+
+// Text renders the text as plain text
+func (t JIRAText) Text() string { return defaultConverter.Text(string(t)) }
+
+// MarkupConverter converts JIRA wiki markup and ADF documents to Slack
+// mrkdwn, HipChat HTML and plain text.
+type MarkupConverter struct {
+	// Optional hook rendering user mentions, e.g. as Slack <@U123>
+	// mentions. It receives the JIRA user name or account id and the
+	// display text of the mention and returns the rendered mention, which
+	// is not escaped. Return an empty string to use the default rendering.
+	Mention func(id, display string) string
+}
+
+var defaultConverter = &MarkupConverter{}
+
+// ToMrkdwn converts wiki markup or ADF to Slack mrkdwn
+func ToMrkdwn(src string) string { return defaultConverter.Mrkdwn(src) }
+
+// ToHTML converts wiki markup or ADF to the HTML subset HipChat renders
+func ToHTML(src string) string { return defaultConverter.HTML(src) }
+
+// ToText converts wiki markup or ADF to plain text
+func ToText(src string) string { return defaultConverter.Text(src) }
+
+// Mrkdwn converts wiki markup or ADF to Slack mrkdwn
+func (c *MarkupConverter) Mrkdwn(src string) string {
+	return c.render(src, markupMrkdwn)
+}
+
+// HTML converts wiki markup or ADF to the HTML subset HipChat renders
+func (c *MarkupConverter) HTML(src string) string {
+	return c.render(src, markupHTML)
+}
+
+// Text converts wiki markup or ADF to plain text
+func (c *MarkupConverter) Text(src string) string {
+	return c.render(src, markupText)
+}
+
+func (c *MarkupConverter) render(src string, format markupFormat) string {
+	var blocks []*mdNode
+	if doc, ok := parseADF(src); ok {
+		blocks = adfBlocks(doc.Content)
+	} else {
+		blocks = parseWikiBlocks(src)
+	}
+	w := &markupWriter{format: format, conv: c}
+	return strings.TrimSpace(w.blocks(blocks))
+}
+
+type markupFormat int
+
+const (
+	markupMrkdwn markupFormat = iota
+	markupHTML
+	markupText
+)
+
+// mdKind is the kind of a node in the document tree shared by the wiki
+// markup and ADF parsers
+type mdKind int
+
+const (
+	blockParagraph mdKind = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockList
+	blockItem
+	blockTable
+	blockRow
+	blockCell
+	blockRule
+
+	inlineText
+	inlineStrong
+	inlineEm
+	inlineStrike
+	inlineUnderline
+	inlineCode
+	inlineLink
+	inlineMention
+	inlineEmoji
+	inlineImage
+	inlineBreak
+)
+
+// mdNode is a block or inline element of a document
+type mdNode struct {
+	kind mdKind
+
+	// Text content, code, emoji short name or mention display text
+	text string
+
+	// Link or image URL, code language, mention id or emoji unicode
+	attr string
+
+	// Heading level or list item depth, starting at 0
+	level int
+
+	// Ordered list item or table header cell
+	ordered bool
+	header  bool
+
+	children []*mdNode
+}
+
+func textNode(s string) *mdNode {
+	return &mdNode{kind: inlineText, text: s}
+}
+
+// Emoticons understood by JIRA and their Slack short name and unicode
+var wikiEmoticons = []struct{ wiki, short, unicode string }{
+	{":)", ":slightly_smiling_face:", "🙂"},
+	{":(", ":disappointed:", "😞"},
+	{":P", ":stuck_out_tongue:", "😛"},
+	{":D", ":smiley:", "😃"},
+	{";)", ":wink:", "😉"},
+	{"(y)", ":thumbsup:", "👍"},
+	{"(n)", ":thumbsdown:", "👎"},
+	{"(i)", ":information_source:", "ℹ️"},
+	{"(/)", ":white_check_mark:", "✅"},
+	{"(x)", ":x:", "❌"},
+	{"(!)", ":warning:", "⚠️"},
+	{"(+)", ":heavy_plus_sign:", "➕"},
+	{"(-)", ":heavy_minus_sign:", "➖"},
+	{"(?)", ":question:", "❓"},
+	{"(on)", ":bulb:", "💡"},
+	{"(off)", ":bulb:", "💡"},
+	{"(*)", ":star:", "⭐"},
+}
+
+var (
+	wikiBlockPattern = regexp.MustCompile(
+		`(?s)\{(code|noformat|quote|panel)(:[^}]*)?\}(.*?)\{(code|noformat|quote|panel)\}`)
+	wikiHeadingPattern = regexp.MustCompile(`^h([1-6])\.\s+(.*)$`)
+	wikiQuotePattern   = regexp.MustCompile(`^bq\.\s+(.*)$`)
+	wikiRulePattern    = regexp.MustCompile(`^-{4,}\s*$`)
+	wikiListPattern    = regexp.MustCompile(`^([*#-]+)\s+(.*)$`)
+)
+
+// parseWikiBlocks parses JIRA wiki markup
+//
+// https://jira.atlassian.com/secure/WikiRendererHelpAction.jspa?section=all
+func parseWikiBlocks(src string) []*mdNode {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+
+	var blocks []*mdNode
+	for {
+		m := wikiBlockPattern.FindStringSubmatchIndex(src)
+		if m == nil {
+			return append(blocks, parseWikiLines(src)...)
+		}
+		blocks = append(blocks, parseWikiLines(src[:m[0]])...)
+
+		kind := src[m[2]:m[3]]
+		content := src[m[6]:m[7]]
+		switch kind {
+		case "code", "noformat":
+			lang := ""
+			if m[4] >= 0 && kind == "code" {
+				lang = strings.TrimPrefix(src[m[4]:m[5]], ":")
+				// {code:title=Foo.java|borderStyle=solid} has no language
+				if strings.Contains(lang, "=") {
+					lang = ""
+				}
+			}
+			blocks = append(blocks, &mdNode{
+				kind: blockCode,
+				attr: lang,
+				text: strings.Trim(content, "\n"),
+			})
+		default:
+			blocks = append(blocks, &mdNode{
+				kind:     blockQuote,
+				children: parseWikiBlocks(content),
+			})
+		}
+		src = src[m[1]:]
+	}
+}
+
+// parseWikiLines parses wiki markup without code, quote or panel blocks
+func parseWikiLines(src string) []*mdNode {
+	var blocks []*mdNode
+	var para []string
+	var list, table *mdNode
+
+	flush := func() {
+		if len(para) > 0 {
+			p := &mdNode{kind: blockParagraph}
+			for i, line := range para {
+				if i > 0 {
+					p.children = append(p.children, &mdNode{kind: inlineBreak})
+				}
+				p.children = append(p.children, parseWikiInline(line)...)
+			}
+			blocks = append(blocks, p)
+			para = nil
+		}
+		list = nil
+		table = nil
+	}
+
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "|") {
+			if table == nil {
+				flush()
+				table = &mdNode{kind: blockTable}
+				blocks = append(blocks, table)
+			}
+			table.children = append(table.children, parseWikiRow(trimmed))
+			continue
+		}
+
+		if m := wikiListPattern.FindStringSubmatch(trimmed); m != nil &&
+			!wikiRulePattern.MatchString(trimmed) {
+			if list == nil {
+				flush()
+				list = &mdNode{kind: blockList}
+				blocks = append(blocks, list)
+			}
+			marker := m[1]
+			list.children = append(list.children, &mdNode{
+				kind:     blockItem,
+				level:    len(marker) - 1,
+				ordered:  strings.HasSuffix(marker, "#"),
+				children: parseWikiInline(m[2]),
+			})
+			continue
+		}
+
+		switch m := wikiHeadingPattern.FindStringSubmatch(trimmed); {
+		case len(trimmed) == 0:
+			flush()
+		case m != nil:
+			flush()
+			blocks = append(blocks, &mdNode{
+				kind:     blockHeading,
+				level:    int(m[1][0] - '0'),
+				children: parseWikiInline(m[2]),
+			})
+		case wikiRulePattern.MatchString(trimmed):
+			flush()
+			blocks = append(blocks, &mdNode{kind: blockRule})
+		case wikiQuotePattern.MatchString(trimmed):
+			flush()
+			q := wikiQuotePattern.FindStringSubmatch(trimmed)[1]
+			blocks = append(blocks, &mdNode{
+				kind: blockQuote,
+				children: []*mdNode{{
+					kind:     blockParagraph,
+					children: parseWikiInline(q),
+				}},
+			})
+		default:
+			list = nil
+			table = nil
+			para = append(para, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// parseWikiRow parses a table row such as ||Head||Head|| or |Cell|Cell|.
+// Pipes inside links and monospaced text do not start a new cell.
+func parseWikiRow(line string) *mdNode {
+	row := &mdNode{kind: blockRow}
+	var cell *mdNode
+	start := 0
+	depth := 0
+
+	end := func(i int) {
+		if cell != nil {
+			cell.children = parseWikiInline(strings.TrimSpace(line[start:i]))
+			row.children = append(row.children, cell)
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			if depth > 0 {
+				depth--
+			}
+		case '|':
+			if depth > 0 {
+				continue
+			}
+			end(i)
+			header := i+1 < len(line) && line[i+1] == '|'
+			if header {
+				i++
+			}
+			cell = &mdNode{kind: blockCell, header: header}
+			start = i + 1
+		}
+	}
+	// The closing pipe leaves an empty cell behind
+	if cell != nil && len(strings.TrimSpace(line[start:])) > 0 {
+		end(len(line))
+	}
+	return row
+}
+
+// Characters which toggle text effects in wiki markup
+var wikiEffects = map[byte]mdKind{
+	'*': inlineStrong,
+	'_': inlineEm,
+	'-': inlineStrike,
+	'+': inlineUnderline,
+	'?': inlineEm,
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// parseWikiInline parses the text effects, links, mentions, images and
+// emoticons of a single line of wiki markup
+func parseWikiInline(s string) []*mdNode {
+	var nodes []*mdNode
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, textNode(text.String()))
+			text.Reset()
+		}
+	}
+	add := func(n *mdNode) {
+		flush()
+		nodes = append(nodes, n)
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		switch {
+		case strings.HasPrefix(rest, `\\`):
+			add(&mdNode{kind: inlineBreak})
+			i += 2
+			continue
+		case strings.HasPrefix(rest, "{{"):
+			if end := strings.Index(rest[2:], "}}"); end >= 0 {
+				add(&mdNode{kind: inlineCode, text: rest[2 : 2+end]})
+				i += end + 4
+				continue
+			}
+		case strings.HasPrefix(rest, "{color"):
+			// Colors can't be rendered, drop the markup and keep the text
+			if end := strings.Index(rest, "}"); end >= 0 {
+				i += end + 1
+				continue
+			}
+		case rest[0] == '[':
+			if n, size := parseWikiLink(rest); n != nil {
+				add(n)
+				i += size
+				continue
+			}
+		case rest[0] == '!':
+			if end := strings.Index(rest[1:], "!"); end > 0 {
+				inner := rest[1 : 1+end]
+				src := strings.SplitN(inner, "|", 2)[0]
+				if !strings.ContainsAny(src, " \t") {
+					add(&mdNode{kind: inlineImage, attr: src})
+					i += end + 2
+					continue
+				}
+			}
+		case strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://"):
+			if i == 0 || !isWordChar(s[i-1]) {
+				end := strings.IndexAny(rest, " \t|]")
+				if end < 0 {
+					end = len(rest)
+				}
+				url := strings.TrimRight(rest[:end], ".,;:)")
+				add(&mdNode{kind: inlineLink, attr: url,
+					children: []*mdNode{textNode(url)}})
+				i += len(url)
+				continue
+			}
+		}
+
+		if n, size := parseWikiEffect(s, i); n != nil {
+			add(n)
+			i += size
+			continue
+		}
+
+		if i > 0 && isWordChar(s[i-1]) {
+			// f(x) is not an emoticon
+		} else if emoticon := matchEmoticon(rest); emoticon >= 0 {
+			e := wikiEmoticons[emoticon]
+			add(&mdNode{kind: inlineEmoji, text: e.short, attr: e.unicode})
+			i += len(e.wiki)
+			continue
+		}
+
+		text.WriteByte(s[i])
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// safeURL returns true for the http, https and mailto URLs rendered as
+// links. Anything else, e.g. javascript: URLs, is left as text.
+func safeURL(u string) bool {
+	lower := strings.ToLower(u)
+	for _, prefix := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, prefix) && len(u) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWikiLink parses [text|url], [url] and [~user] at the start of s
+func parseWikiLink(s string) (*mdNode, int) {
+	end := strings.Index(s, "]")
+	if end < 0 {
+		return nil, 0
+	}
+	inner := s[1:end]
+
+	if strings.HasPrefix(inner, "~") {
+		id := strings.TrimPrefix(inner[1:], "accountid:")
+		return &mdNode{kind: inlineMention, attr: id, text: id}, end + 1
+	}
+
+	parts := strings.Split(inner, "|")
+	url := parts[0]
+	label := parts[0]
+	if len(parts) > 1 {
+		url = parts[1]
+	}
+	if !safeURL(url) {
+		return nil, 0
+	}
+	url = strings.TrimSpace(url)
+	return &mdNode{
+		kind:     inlineLink,
+		attr:     url,
+		children: parseWikiInline(strings.TrimSpace(label)),
+	}, end + 1
+}
+
+// parseWikiEffect parses text effects such as *strong* at s[i]. Effects
+// must start at a word boundary and hug the text they apply to so that
+// hyphenated-words and 2 * 3 are left alone.
+func parseWikiEffect(s string, i int) (*mdNode, int) {
+	c := s[i]
+	kind, ok := wikiEffects[c]
+	if !ok {
+		return nil, 0
+	}
+	delim := string(c)
+	if c == '?' {
+		// Citations are ??text??
+		delim = "??"
+		if !strings.HasPrefix(s[i:], delim) {
+			return nil, 0
+		}
+	}
+
+	open := i + len(delim)
+	if i > 0 && isWordChar(s[i-1]) || open >= len(s) || isSpace(s[open]) ||
+		s[open] == c {
+		return nil, 0
+	}
+
+	for j := open + 1; j+len(delim) <= len(s); j++ {
+		if !strings.HasPrefix(s[j:], delim) {
+			continue
+		}
+		after := j + len(delim)
+		if isSpace(s[j-1]) || after < len(s) && isWordChar(s[after]) {
+			continue
+		}
+		return &mdNode{kind: kind, children: parseWikiInline(s[open:j])},
+			after - i
+	}
+	return nil, 0
+}
+
+// matchEmoticon returns the index of the emoticon at the start of s or -1.
+// Smileys must not be followed by a word character so that :Doc stays
+// intact.
+func matchEmoticon(s string) int {
+	for i, e := range wikiEmoticons {
+		if !strings.HasPrefix(s, e.wiki) {
+			continue
+		}
+		if n := len(e.wiki); e.wiki[0] != '(' && n < len(s) && isWordChar(s[n]) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// adfNode is a node of an Atlassian Document Format document
+//
+// https://developer.atlassian.com/cloud/jira/platform/apis/document/structure/
+type adfNode struct {
+	Type    string                 `json:"type"`
+	Text    string                 `json:"text,omitempty"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Marks   []adfNode              `json:"marks,omitempty"`
+	Content []adfNode              `json:"content,omitempty"`
+}
+
+func (n *adfNode) attr(name string) string {
+	switch v := n.Attrs[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// parseADF returns the document if src is an ADF document
+func parseADF(src string) (*adfNode, bool) {
+	src = strings.TrimSpace(src)
+	if !strings.HasPrefix(src, "{") {
+		return nil, false
+	}
+	var doc adfNode
+	if err := json.Unmarshal([]byte(src), &doc); err != nil || doc.Type != "doc" {
+		return nil, false
+	}
+	return &doc, true
+}
+
+func adfBlocks(nodes []adfNode) []*mdNode {
+	var blocks []*mdNode
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.Type {
+		case "paragraph":
+			blocks = append(blocks, &mdNode{
+				kind:     blockParagraph,
+				children: adfInlines(n.Content),
+			})
+		case "heading":
+			level := 1
+			if l, ok := n.Attrs["level"].(float64); ok {
+				level = int(l)
+			}
+			blocks = append(blocks, &mdNode{
+				kind:     blockHeading,
+				level:    level,
+				children: adfInlines(n.Content),
+			})
+		case "codeBlock":
+			var code strings.Builder
+			for _, t := range n.Content {
+				code.WriteString(t.Text)
+			}
+			blocks = append(blocks, &mdNode{
+				kind: blockCode,
+				attr: n.attr("language"),
+				text: code.String(),
+			})
+		case "blockquote", "panel", "expand", "nestedExpand":
+			blocks = append(blocks, &mdNode{
+				kind:     blockQuote,
+				children: adfBlocks(n.Content),
+			})
+		case "bulletList", "orderedList":
+			list := &mdNode{kind: blockList}
+			adfList(n, 0, list)
+			blocks = append(blocks, list)
+		case "table":
+			table := &mdNode{kind: blockTable}
+			for _, r := range n.Content {
+				row := &mdNode{kind: blockRow}
+				for j := range r.Content {
+					c := &r.Content[j]
+					row.children = append(row.children, &mdNode{
+						kind:     blockCell,
+						header:   c.Type == "tableHeader",
+						children: adfFlatten(c.Content),
+					})
+				}
+				table.children = append(table.children, row)
+			}
+			blocks = append(blocks, table)
+		case "rule":
+			blocks = append(blocks, &mdNode{kind: blockRule})
+		case "mediaSingle", "mediaGroup", "blockCard":
+			blocks = append(blocks, &mdNode{
+				kind:     blockParagraph,
+				children: adfInlines([]adfNode{*n}),
+			})
+		default:
+			// Unknown block, keep whatever text it has
+			if len(n.Content) > 0 {
+				blocks = append(blocks, adfBlocks(n.Content)...)
+			}
+		}
+	}
+	return blocks
+}
+
+// adfList flattens nested lists into items with increasing depth
+func adfList(n *adfNode, level int, list *mdNode) {
+	ordered := n.Type == "orderedList"
+	for _, item := range n.Content {
+		var inlines []*mdNode
+		var nested []adfNode
+		for _, c := range item.Content {
+			if c.Type == "bulletList" || c.Type == "orderedList" {
+				nested = append(nested, c)
+				continue
+			}
+			if len(inlines) > 0 {
+				inlines = append(inlines, &mdNode{kind: inlineBreak})
+			}
+			inlines = append(inlines, adfFlatten([]adfNode{c})...)
+		}
+		list.children = append(list.children, &mdNode{
+			kind:     blockItem,
+			level:    level,
+			ordered:  ordered,
+			children: inlines,
+		})
+		for i := range nested {
+			adfList(&nested[i], level+1, list)
+		}
+	}
+}
+
+// adfFlatten returns the inline content of blocks such as the paragraphs
+// of a table cell, separated by line breaks
+func adfFlatten(nodes []adfNode) []*mdNode {
+	var inlines []*mdNode
+	for _, n := range nodes {
+		if len(inlines) > 0 {
+			inlines = append(inlines, &mdNode{kind: inlineBreak})
+		}
+		if n.Type == "paragraph" || n.Type == "heading" {
+			inlines = append(inlines, adfInlines(n.Content)...)
+		} else {
+			inlines = append(inlines, adfInlines([]adfNode{n})...)
+		}
+	}
+	return inlines
+}
+
+func adfInlines(nodes []adfNode) []*mdNode {
+	var inlines []*mdNode
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.Type {
+		case "text":
+			inlines = append(inlines, adfMarks(n))
+		case "hardBreak":
+			inlines = append(inlines, &mdNode{kind: inlineBreak})
+		case "mention":
+			display := strings.TrimPrefix(n.attr("text"), "@")
+			if len(display) == 0 {
+				display = n.attr("id")
+			}
+			inlines = append(inlines, &mdNode{
+				kind: inlineMention,
+				attr: n.attr("id"),
+				text: display,
+			})
+		case "emoji":
+			inlines = append(inlines, &mdNode{
+				kind: inlineEmoji,
+				text: n.attr("shortName"),
+				attr: n.attr("text"),
+			})
+		case "inlineCard", "blockCard":
+			url := n.attr("url")
+			inlines = append(inlines, &mdNode{
+				kind:     inlineLink,
+				attr:     url,
+				children: []*mdNode{textNode(url)},
+			})
+		case "status":
+			inlines = append(inlines, &mdNode{
+				kind:     inlineStrong,
+				children: []*mdNode{textNode(strings.ToUpper(n.attr("text")))},
+			})
+		case "date":
+			var ms int64
+			fmt.Sscan(n.attr("timestamp"), &ms)
+			date := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+			inlines = append(inlines, textNode(date.Format("2006-01-02")))
+		case "media":
+			name := n.attr("alt")
+			if len(name) == 0 {
+				name = n.attr("id")
+			}
+			inlines = append(inlines, &mdNode{kind: inlineImage, attr: name})
+		default:
+			inlines = append(inlines, adfInlines(n.Content)...)
+		}
+	}
+	return inlines
+}
+
+// adfMarks wraps a text node in its marks, code and links outermost
+func adfMarks(n *adfNode) *mdNode {
+	node := textNode(n.Text)
+	var link string
+	for _, m := range n.Marks {
+		var kind mdKind
+		switch m.Type {
+		case "strong":
+			kind = inlineStrong
+		case "em":
+			kind = inlineEm
+		case "strike":
+			kind = inlineStrike
+		case "underline":
+			kind = inlineUnderline
+		case "code":
+			node = &mdNode{kind: inlineCode, text: n.Text}
+			continue
+		case "link":
+			if href := m.attr("href"); safeURL(href) {
+				link = href
+			}
+			continue
+		default:
+			continue
+		}
+		if node.kind != inlineCode {
+			node = &mdNode{kind: kind, children: []*mdNode{node}}
+		}
+	}
+	if len(link) > 0 {
+		node = &mdNode{kind: inlineLink, attr: link, children: []*mdNode{node}}
+	}
+	return node
+}
+
+// markupWriter renders a document tree in one of the output formats
+type markupWriter struct {
+	format markupFormat
+	conv   *MarkupConverter
+}
+
+// escape escapes text for the output format
+func (w *markupWriter) escape(s string) string {
+	switch w.format {
+	case markupMrkdwn:
+		return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+	case markupHTML:
+		return html.EscapeString(s)
+	}
+	return s
+}
+
+func (w *markupWriter) blocks(blocks []*mdNode) string {
+	var parts []string
+	for _, b := range blocks {
+		if s := w.block(b); len(s) > 0 {
+			parts = append(parts, s)
+		}
+	}
+	if w.format == markupHTML {
+		return strings.Join(parts, "<br>")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (w *markupWriter) block(b *mdNode) string {
+	switch b.kind {
+	case blockParagraph:
+		return w.inlines(b.children)
+	case blockHeading:
+		text := w.inlines(b.children)
+		switch w.format {
+		case markupMrkdwn:
+			return "*" + text + "*"
+		case markupHTML:
+			return "<b>" + text + "</b>"
+		}
+		return strings.ToUpper(text)
+	case blockCode:
+		switch w.format {
+		case markupMrkdwn:
+			return "```\n" + w.escape(b.text) + "\n```"
+		case markupHTML:
+			return "<pre>" + html.EscapeString(b.text) + "</pre>"
+		}
+		return b.text
+	case blockQuote:
+		inner := w.blocks(b.children)
+		if w.format == markupHTML {
+			return "<blockquote>" + inner + "</blockquote>"
+		}
+		lines := strings.Split(inner, "\n")
+		for i := range lines {
+			lines[i] = "> " + lines[i]
+		}
+		return strings.Join(lines, "\n")
+	case blockList:
+		return w.list(b.children)
+	case blockTable:
+		return w.table(b)
+	case blockRule:
+		if w.format == markupHTML {
+			return "<hr>"
+		}
+		return "──────────"
+	}
+	return ""
+}
+
+// list renders flattened list items, nesting HTML lists by depth
+func (w *markupWriter) list(items []*mdNode) string {
+	var out strings.Builder
+	if w.format == markupHTML {
+		var open []string
+		for _, item := range items {
+			tag := "ul"
+			if item.ordered {
+				tag = "ol"
+			}
+			for len(open) > item.level+1 {
+				out.WriteString("</" + open[len(open)-1] + ">")
+				open = open[:len(open)-1]
+			}
+			if len(open) == item.level+1 && open[item.level] != tag {
+				out.WriteString("</" + open[item.level] + ">")
+				open = open[:item.level]
+			}
+			for len(open) < item.level+1 {
+				out.WriteString("<" + tag + ">")
+				open = append(open, tag)
+			}
+			out.WriteString("<li>" + w.inlines(item.children) + "</li>")
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			out.WriteString("</" + open[i] + ">")
+		}
+		return out.String()
+	}
+
+	counters := map[int]int{}
+	for i, item := range items {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		// Deeper items restart numbering once their parent moves on
+		for l := range counters {
+			if l > item.level {
+				delete(counters, l)
+			}
+		}
+		bullet := "•"
+		if w.format == markupText {
+			bullet = "-"
+		}
+		if item.ordered {
+			counters[item.level]++
+			bullet = fmt.Sprintf("%d.", counters[item.level])
+		}
+		out.WriteString(strings.Repeat("    ", item.level))
+		out.WriteString(bullet + " " + w.inlines(item.children))
+	}
+	return out.String()
+}
+
+func (w *markupWriter) table(t *mdNode) string {
+	var rows []string
+	for _, r := range t.children {
+		var cells []string
+		for _, c := range r.children {
+			text := w.inlines(c.children)
+			switch {
+			case w.format == markupHTML && c.header:
+				text = "<th>" + text + "</th>"
+			case w.format == markupHTML:
+				text = "<td>" + text + "</td>"
+			case w.format == markupMrkdwn && c.header && len(text) > 0:
+				text = "*" + text + "*"
+			}
+			cells = append(cells, text)
+		}
+		if w.format == markupHTML {
+			rows = append(rows, "<tr>"+strings.Join(cells, "")+"</tr>")
+		} else {
+			rows = append(rows, strings.Join(cells, " | "))
+		}
+	}
+	if w.format == markupHTML {
+		return "<table>" + strings.Join(rows, "") + "</table>"
+	}
+	return strings.Join(rows, "\n")
+}
+
+func (w *markupWriter) inlines(nodes []*mdNode) string {
+	var out strings.Builder
+	for _, n := range nodes {
+		out.WriteString(w.inline(n))
+	}
+	return out.String()
+}
+
+func (w *markupWriter) inline(n *mdNode) string {
+	wrap := func(mrkdwn, tag string) string {
+		inner := w.inlines(n.children)
+		switch {
+		case w.format == markupMrkdwn && len(mrkdwn) > 0:
+			return mrkdwn + inner + mrkdwn
+		case w.format == markupHTML:
+			return "<" + tag + ">" + inner + "</" + tag + ">"
+		}
+		return inner
+	}
+
+	switch n.kind {
+	case inlineText:
+		return w.escape(n.text)
+	case inlineStrong:
+		return wrap("*", "b")
+	case inlineEm:
+		return wrap("_", "i")
+	case inlineStrike:
+		return wrap("~", "s")
+	case inlineUnderline:
+		// Slack has no underline
+		return wrap("", "u")
+	case inlineCode:
+		switch w.format {
+		case markupMrkdwn:
+			return "`" + w.escape(n.text) + "`"
+		case markupHTML:
+			return "<code>" + w.escape(n.text) + "</code>"
+		}
+		return n.text
+	case inlineLink:
+		text := w.inlines(n.children)
+		switch w.format {
+		case markupMrkdwn:
+			return "<" + n.attr + "|" + text + ">"
+		case markupHTML:
+			return `<a href="` + html.EscapeString(n.attr) + `">` + text + "</a>"
+		}
+		if text == n.attr {
+			return text
+		}
+		return text + " (" + n.attr + ")"
+	case inlineMention:
+		if w.conv.Mention != nil {
+			if m := w.conv.Mention(n.attr, n.text); len(m) > 0 {
+				return m
+			}
+		}
+		return "@" + w.escape(n.text)
+	case inlineEmoji:
+		if w.format == markupMrkdwn && len(n.text) > 0 {
+			return n.text
+		}
+		if len(n.attr) > 0 {
+			return n.attr
+		}
+		return n.text
+	case inlineImage:
+		if safeURL(n.attr) {
+			switch w.format {
+			case markupMrkdwn:
+				return "<" + n.attr + "|image>"
+			case markupHTML:
+				return `<a href="` + html.EscapeString(n.attr) + `">image</a>`
+			}
+			return n.attr
+		}
+		return w.escape("[image: " + n.attr + "]")
+	case inlineBreak:
+		if w.format == markupHTML {
+			return "<br>"
+		}
+		return "\n"
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWikiMarkup(t *testing.T) {
+	tests := []struct {
+		name, src, mrkdwn, html, text string
+	}{
+		{
+			name:   "effects",
+			src:    "*bold* _italic_ -gone- {{code}} well-known 2 * 3",
+			mrkdwn: "*bold* _italic_ ~gone~ `code` well-known 2 * 3",
+			html:   "<b>bold</b> <i>italic</i> <s>gone</s> <code>code</code> well-known 2 * 3",
+			text:   "bold italic gone code well-known 2 * 3",
+		},
+		{
+			name:   "links and mentions",
+			src:    "[~mmcfly] see [the docs|https://example.com/a?b=1&c=2] (y)",
+			mrkdwn: "@mmcfly see <https://example.com/a?b=1&c=2|the docs> :thumbsup:",
+			html:   `@mmcfly see <a href="https://example.com/a?b=1&amp;c=2">the docs</a> 👍`,
+			text:   "@mmcfly see the docs (https://example.com/a?b=1&c=2) 👍",
+		},
+		{
+			name:   "code block",
+			src:    "before\n{code:java}\nint a = b < c;\n{code}\nafter",
+			mrkdwn: "before\n\n```\nint a = b &lt; c;\n```\n\nafter",
+			html:   "before<br><pre>int a = b &lt; c;</pre><br>after",
+			text:   "before\n\nint a = b < c;\n\nafter",
+		},
+		{
+			name:   "code block mentions and links",
+			src:    "{code}\n<!channel> <https://evil.example.com|PROJ-1>\n{code}",
+			mrkdwn: "```\n&lt;!channel&gt; &lt;https://evil.example.com|PROJ-1&gt;\n```",
+			html:   "<pre>&lt;!channel&gt; &lt;https://evil.example.com|PROJ-1&gt;</pre>",
+			text:   "<!channel> <https://evil.example.com|PROJ-1>",
+		},
+		{
+			name:   "unsafe links",
+			src:    "[click|javascript://alert(1)] [x|data://text/html,hi] [mail|mailto:marty@example.com]",
+			mrkdwn: "[click|javascript://alert(1)] [x|data://text/html,hi] <mailto:marty@example.com|mail>",
+			html:   `[click|javascript://alert(1)] [x|data://text/html,hi] <a href="mailto:marty@example.com">mail</a>`,
+			text:   "[click|javascript://alert(1)] [x|data://text/html,hi] mail (mailto:marty@example.com)",
+		},
+		{
+			name:   "lists",
+			src:    "* one\n** nested\n# first\n# second",
+			mrkdwn: "• one\n    • nested\n1. first\n2. second",
+			html:   "<ul><li>one</li><ul><li>nested</li></ul></ul><ol><li>first</li><li>second</li></ol>",
+			text:   "- one\n    - nested\n1. first\n2. second",
+		},
+		{
+			name:   "table",
+			src:    "||Key||Status||\n|PROJ-1|[Done|https://example.com]|",
+			mrkdwn: "*Key* | *Status*\nPROJ-1 | <https://example.com|Done>",
+			html:   `<table><tr><th>Key</th><th>Status</th></tr><tr><td>PROJ-1</td><td><a href="https://example.com">Done</a></td></tr></table>`,
+			text:   "Key | Status\nPROJ-1 | Done (https://example.com)",
+		},
+		{
+			name:   "image and heading",
+			src:    "h2. Screenshot\n!screen.png|thumbnail!",
+			mrkdwn: "*Screenshot*\n\n[image: screen.png]",
+			html:   "<b>Screenshot</b><br>[image: screen.png]",
+			text:   "SCREENSHOT\n\n[image: screen.png]",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ToMrkdwn(tt.src); got != tt.mrkdwn {
+			t.Errorf("%s: mrkdwn\ngot  %q\nwant %q", tt.name, got, tt.mrkdwn)
+		}
+		if got := ToHTML(tt.src); got != tt.html {
+			t.Errorf("%s: html\ngot  %q\nwant %q", tt.name, got, tt.html)
+		}
+		if got := ToText(tt.src); got != tt.text {
+			t.Errorf("%s: text\ngot  %q\nwant %q", tt.name, got, tt.text)
+		}
+	}
+}
+
+const testADF = `{"version":1,"type":"doc","content":[
+	{"type":"paragraph","content":[
+		{"type":"text","text":"Hey "},
+		{"type":"mention","attrs":{"id":"5b10ac8d82e05b22cc7d4ef5","text":"@Marty McFly"}},
+		{"type":"text","text":" this is "},
+		{"type":"text","text":"broken","marks":[{"type":"strong"}]},
+		{"type":"text","text":" "},
+		{"type":"emoji","attrs":{"shortName":":fire:","text":"🔥"}}
+	]},
+	{"type":"bulletList","content":[
+		{"type":"listItem","content":[
+			{"type":"paragraph","content":[{"type":"text","text":"see",
+				"marks":[{"type":"link","attrs":{"href":"https://example.com"}}]}]}
+		]}
+	]},
+	{"type":"codeBlock","attrs":{"language":"go"},"content":[{"type":"text","text":"panic(err)"}]}
+]}`
+
+func TestADFMarkup(t *testing.T) {
+	var comment JIRAComment
+	body := `{"id":"1","body":` + testADF + `}`
+	if err := json.Unmarshal([]byte(body), &comment); err != nil {
+		t.Fatal(err)
+	}
+	if !comment.Body.IsADF() {
+		t.Fatal("body was not decoded as ADF")
+	}
+
+	want := "Hey @Marty McFly this is *broken* :fire:\n\n• <https://example.com|see>\n\n```\npanic(err)\n```"
+	if got := comment.Body.Mrkdwn(); got != want {
+		t.Errorf("mrkdwn\ngot  %q\nwant %q", got, want)
+	}
+
+	conv := &MarkupConverter{Mention: func(id, display string) string {
+		return "<@U" + id[:3] + ">"
+	}}
+	want = "Hey <@U5b1> this is broken 🔥\n\n- see (https://example.com)\n\npanic(err)"
+	if got := conv.Text(string(comment.Body)); got != want {
+		t.Errorf("text\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestADFUnsafeLink(t *testing.T) {
+	src := `{"version":1,"type":"doc","content":[{"type":"paragraph","content":[
+		{"type":"text","text":"click","marks":[{"type":"link","attrs":{"href":"javascript://alert(1)"}}]}]}]}`
+	if got := ToHTML(src); got != "click" {
+		t.Errorf("html = %q", got)
+	}
+}
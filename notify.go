@@ -0,0 +1,256 @@
+package jirachat
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+)
+
+// Kinds of personal notifications users can opt out of
+const (
+	NotifyAssigned = "assigned"
+	NotifyComment  = "comment"
+	NotifyWatching = "watching"
+	NotifyAll      = "all"
+)
+
+// PreferenceStore records the personal notifications each user opted out
+// of. Users are identified by their account id on JIRA Cloud and by their
+// user name on JIRA Server. Implement it on top of your datastore of
+// choice when running more than one instance.
+type PreferenceStore interface {
+	OptedOut(user, kind string) (bool, error)
+	SetOptOut(user, kind string, optOut bool) error
+}
+
+// MemoryPreferenceStore is a PreferenceStore kept in process memory
+type MemoryPreferenceStore struct {
+	mu     sync.Mutex
+	optOut map[string]bool
+}
+
+// Create a new, empty, in memory PreferenceStore
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{optOut: make(map[string]bool)}
+}
+
+func (m *MemoryPreferenceStore) OptedOut(user, kind string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.optOut[user+"/"+kind], nil
+}
+
+func (m *MemoryPreferenceStore) SetOptOut(user, kind string, optOut bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if optOut {
+		m.optOut[user+"/"+kind] = true
+	} else {
+		delete(m.optOut, user+"/"+kind)
+	}
+	return nil
+}
+
+// PersonalNotifier sends direct messages to the people affected by an
+// event: the new assignee when an issue is reassigned, and the assignee
+// and watchers when someone else comments on the issue. Messages go to
+// Slack when Slack is set, the user being mapped to a member id, and to
+// HipChat when Hip is set.
+type PersonalNotifier struct {
+	// Slack service used to send direct messages. Requires Token.
+	Slack *SlackService
+
+	// HipChat service used to send private messages
+	Hip *hipService
+
+	// Optional per-user opt-out preferences
+	Preferences PreferenceStore
+
+	// Optional JIRA client used to fetch the watchers of commented
+	// issues. Watchers are not notified without it.
+	JIRA *JIRAClient
+}
+
+// personalMessage is a notification for a single user
+type personalMessage struct {
+	kind  string
+	to    JIRAIssueAssignee
+	slack string
+	html  string
+}
+
+// userId identifies a JIRA user: by account id on JIRA Cloud, where user
+// names are gone, and by name or key on JIRA Server. Preferences are
+// recorded for it.
+func userId(accountId, name, key, email string) string {
+	for _, id := range []string{accountId, name, key} {
+		if len(id) > 0 {
+			return id
+		}
+	}
+	return strings.ToLower(email)
+}
+
+func (u *JIRAUser) id() string {
+	return userId(u.AccountId, u.Name, u.Key, u.EmailAddress)
+}
+
+func (a *JIRAIssueAssignee) id() string {
+	return userId(a.AccountId, a.Name, a.Key, a.Email)
+}
+
+// Notify sends the direct messages for the event, if any
+func (n *PersonalNotifier) Notify(event *JIRAWebevent) error {
+	msgs, err := n.messages(event)
+	for _, msg := range msgs {
+		if sendErr := n.send(event, msg); sendErr != nil && err == nil {
+			err = sendErr
+		}
+	}
+	return err
+}
+
+// send delivers a message unless its user opted out of its kind
+func (n *PersonalNotifier) send(event *JIRAWebevent, msg *personalMessage) error {
+	if n.Preferences != nil {
+		for _, kind := range []string{msg.kind, NotifyAll} {
+			out, err := n.Preferences.OptedOut(msg.to.id(), kind)
+			if err != nil {
+				return err
+			}
+			if out {
+				return nil
+			}
+		}
+	}
+
+	if n.Slack != nil {
+		config := n.Slack.Config
+		if id := config.SlackUserId(msg.to.Email, msg.to.Name); len(id) > 0 {
+			text := msg.slack
+			if !event.Timestamp.IsZero() {
+				text += "\n" + event.Timestamp.SlackDate(SlackDateFormat)
+			}
+			payload := SlackMessage{
+				Channel:  id,
+				Username: config.BotName,
+				Text:     text,
+			}
+			if _, err := payload.PostMessage(config); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.Hip != nil && len(msg.to.Email) > 0 {
+		// HipChat shows no time zone aware dates, use the user's
+		body := msg.html
+		if !event.Timestamp.IsZero() {
+			body += "<br><i>" + html.EscapeString(
+				event.Timestamp.FormatIn(msg.to.Timezone)) + "</i>"
+		}
+		req := &MessageRequest{
+			Message:       body,
+			Notify:        true,
+			MessageFormat: FormatHTML,
+		}
+		req.moreURL_, req.more_ = event.moreLink(n.Hip.config_.Domain)
+		_, err := n.Hip.PrivateMessage(msg.to.Email, req)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messages returns the notifications for the event, one per affected
+// user. Users are never notified about their own actions. Watchers which
+// could not be fetched are reported with the messages for the others.
+func (n *PersonalNotifier) messages(event *JIRAWebevent) ([]*personalMessage, error) {
+	link := event.Issue.Key
+	domain := ""
+	if n.Slack != nil {
+		link = event.GetIssueLink(n.Slack.Config)
+		domain = n.Slack.Config.Domain
+	} else if n.Hip != nil {
+		domain = n.Hip.config_.Domain
+	}
+	htmlLink := fmt.Sprintf(`<a href="%s">%s</a>`,
+		fmt.Sprintf(issueLinkBase, domain, event.Issue.Key),
+		html.EscapeString(event.Issue.Key))
+	summary := event.Issue.Fields.Summary
+	assignee := event.Issue.Fields.Assignee
+
+	var msgs []*personalMessage
+	seen := make(map[string]bool)
+	add := func(actor string, msg *personalMessage) {
+		id := msg.to.id()
+		if len(id) == 0 || id == actor || seen[id] {
+			return
+		}
+		seen[id] = true
+		msgs = append(msgs, msg)
+	}
+
+	switch {
+	case len(event.Comment.Id) > 0:
+		author := event.Comment.Author
+		// The issue is described to each recipient, e.g. "your issue"
+		comment := func(issue string) string {
+			return fmt.Sprintf("%s commented on %s %s %s\n%s",
+				author.DisplayName, issue, link, summary, event.Comment.Body.Mrkdwn())
+		}
+		commentHTML := func(issue string) string {
+			return fmt.Sprintf("<b>%s</b> commented on %s %s %s<br>%s",
+				html.EscapeString(author.DisplayName), issue, htmlLink,
+				html.EscapeString(summary), event.Comment.Body.HTML())
+		}
+
+		add(author.id(), &personalMessage{
+			kind:  NotifyComment,
+			to:    assignee,
+			slack: comment("your issue"),
+			html:  commentHTML("your issue"),
+		})
+		if n.JIRA == nil {
+			return msgs, nil
+		}
+		watchers, err := n.JIRA.GetWatchers(event.Issue.Key)
+		for _, w := range watchers {
+			add(author.id(), &personalMessage{
+				kind:  NotifyWatching,
+				to:    w.assignee(),
+				slack: comment("the issue you watch"),
+				html:  commentHTML("the issue you watch"),
+			})
+		}
+		return msgs, err
+	case event.hasChange("assignee"):
+		add(event.User.id(), &personalMessage{
+			kind: NotifyAssigned,
+			to:   assignee,
+			slack: fmt.Sprintf("%s assigned %s %s to you",
+				event.User.DisplayName, link, summary),
+			html: fmt.Sprintf("<b>%s</b> assigned %s %s to you",
+				html.EscapeString(event.User.DisplayName), htmlLink,
+				html.EscapeString(summary)),
+		})
+	}
+	return msgs, nil
+}
+
+// assignee returns the user in the shape of an issue assignee
+func (u *JIRAUser) assignee() JIRAIssueAssignee {
+	return JIRAIssueAssignee{
+		Self:        u.Self,
+		Name:        u.Name,
+		Key:         u.Key,
+		AccountId:   u.AccountId,
+		Email:       u.EmailAddress,
+		AvatarUrls:  u.AvatarUrls,
+		DisplayName: u.DisplayName,
+		Active:      u.Active,
+		Timezone:    u.TimeZone,
+	}
+}
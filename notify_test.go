@@ -0,0 +1,142 @@
+package jirachat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+// Server payloads identify users by name, Cloud ones by account id only
+const (
+	serverComment = `{"webhookEvent": "comment_created",
+		"comment": {"id": "1", "body": "Great Scott!", "author": {"name": %q, "key": %q, "displayName": "Author"}},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Fix it", "assignee": {"name": "mmcfly", "key": "mmcfly"}}}}`
+	cloudComment = `{"webhookEvent": "comment_created",
+		"comment": {"id": "1", "body": "Great Scott!", "author": {"accountId": %q, "displayName": "Author"}},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Fix it", "assignee": {"accountId": "5b10marty"}}}}`
+	serverAssign = `{"webhookEvent": "jira:issue_updated", "user": {"name": %q, "displayName": "Actor"},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Fix it", "assignee": {"name": "mmcfly"}}},
+		"changelog": {"items": [{"field": "assignee", "to": "mmcfly"}]}}`
+	cloudAssign = `{"webhookEvent": "jira:issue_updated", "user": {"accountId": %q, "displayName": "Actor"},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Fix it", "assignee": {"accountId": "5b10marty"}}},
+		"changelog": {"items": [{"field": "assignee", "to": "5b10marty"}]}}`
+)
+
+func TestPersonalMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+	}{
+		{"server comment", fmt.Sprintf(serverComment, "dbrown", "dbrown"), []string{"comment mmcfly"}},
+		{"server own comment", fmt.Sprintf(serverComment, "mmcfly", "mmcfly"), nil},
+		{"cloud comment", fmt.Sprintf(cloudComment, "5b10doc"), []string{"comment 5b10marty"}},
+		{"cloud own comment", fmt.Sprintf(cloudComment, "5b10marty"), nil},
+		{"server assign", fmt.Sprintf(serverAssign, "dbrown"), []string{"assigned mmcfly"}},
+		{"server self assign", fmt.Sprintf(serverAssign, "mmcfly"), nil},
+		{"cloud assign", fmt.Sprintf(cloudAssign, "5b10doc"), []string{"assigned 5b10marty"}},
+		{"cloud self assign", fmt.Sprintf(cloudAssign, "5b10marty"), nil},
+		{"unassigned", `{"webhookEvent": "comment_created", "comment": {"id": "1", "author": {"accountId": "5b10doc"}},
+			"issue": {"key": "PROJ-1", "fields": {}}}`, nil},
+		{"no change", `{"webhookEvent": "jira:issue_updated", "user": {"accountId": "5b10doc"},
+			"issue": {"key": "PROJ-1", "fields": {"assignee": {"accountId": "5b10marty"}}}}`, nil},
+	}
+	n := &PersonalNotifier{}
+	for _, tt := range tests {
+		event := parseString(t, tt.payload)
+		msgs, err := n.messages(&event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, msg := range msgs {
+			got = append(got, msg.kind+" "+msg.to.id())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: messages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPersonalMessagesPercent(t *testing.T) {
+	event := parseString(t, `{"webhookEvent": "comment_created",
+		"comment": {"id": "1", "body": "50% done", "author": {"accountId": "5b10doc", "displayName": "Author"}},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Cut 100% of %d bugs", "assignee": {"accountId": "5b10marty"}}}}`)
+	msgs, err := (&PersonalNotifier{}).messages(&event)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("messages = %v, %v", msgs, err)
+	}
+	for _, text := range []string{msgs[0].slack, msgs[0].html} {
+		if strings.Contains(text, "%!") || !strings.Contains(text, "Cut 100% of %d bugs") ||
+			!strings.Contains(text, "50% done") || !strings.Contains(text, "your issue") {
+			t.Errorf("message = %q", text)
+		}
+	}
+}
+
+func TestPersonalMessagesWatchers(t *testing.T) {
+	jira, _ := newRESTServer(t, map[string]string{
+		"/rest/api/2/issue/PROJ-1/watchers": `{"watchers": [
+			{"accountId": "5b10doc"}, {"accountId": "5b10marty"}, {"accountId": "5b10jennifer"}]}`,
+	})
+	client, err := NewJIRAClient(nil, &JIRAConfig{BaseUrl: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &PersonalNotifier{JIRA: client}
+
+	event := parseString(t, fmt.Sprintf(cloudComment, "5b10doc"))
+	msgs, err := n.messages(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, msg := range msgs {
+		got = append(got, msg.kind+" "+msg.to.id())
+	}
+	if want := "comment 5b10marty,watching 5b10jennifer"; strings.Join(got, ",") != want {
+		t.Errorf("messages = %v, want %s", got, want)
+	}
+	if !strings.Contains(msgs[1].slack, "the issue you watch") {
+		t.Errorf("watcher message = %q", msgs[1].slack)
+	}
+}
+
+func TestNotifyOptOut(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	prefs := NewMemoryPreferenceStore()
+	n := &PersonalNotifier{
+		Slack: newSlackTest(slack, &SlackConfig{
+			Users: UserMap{"mmcfly": "U1", "5b10marty": "U2"},
+		}),
+		Preferences: prefs,
+	}
+	comment := parseString(t, fmt.Sprintf(cloudComment, "5b10doc"))
+	assign := parseString(t, fmt.Sprintf(serverAssign, "dbrown"))
+
+	// Opted out of comments only
+	prefs.SetOptOut("5b10marty", NotifyComment, true)
+	for _, event := range []*JIRAWebevent{&comment, &assign} {
+		if err := n.Notify(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := slack.Messages()
+	var msg SlackMessage
+	if len(msgs) != 1 || msgs[0].JSON(&msg) != nil || msg.Channel != "U1" ||
+		!strings.Contains(msg.Text, "assigned") {
+		t.Fatalf("messages = %+v", msgs)
+	}
+
+	// Opted out of everything
+	prefs.SetOptOut("mmcfly", NotifyAll, true)
+	if err := n.Notify(&assign); err != nil {
+		t.Fatal(err)
+	}
+	if len(slack.Messages()) != 1 {
+		t.Error("opted out user notified")
+	}
+}
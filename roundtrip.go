@@ -0,0 +1,236 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// JSON names of the fields of the structs decoded with extras
+var (
+	webeventNames   = jsonNames(reflect.TypeOf(JIRAWebevent{}))
+	issueNames      = jsonNames(reflect.TypeOf(JIRAIssue{}))
+	issueFieldNames = jsonNames(reflect.TypeOf(IssueFieldData{}))
+	changeItemNames = jsonNames(reflect.TypeOf(ChangleLogItems{}))
+)
+
+// jsonNames returns the JSON names of the struct's fields
+func jsonNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || len(field.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// decodeObject returns the keys of the JSON object in data and its fields
+// missing from known, nil if there are none
+func decodeObject(data []byte, known map[string]bool) (map[string]bool, map[string]json.RawMessage) {
+	var all map[string]json.RawMessage
+	if json.Unmarshal(data, &all) != nil {
+		return nil, nil
+	}
+	keys := make(map[string]bool, len(all))
+	var extra map[string]json.RawMessage
+	for k, v := range all {
+		keys[k] = true
+		if known[k] {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]json.RawMessage)
+		}
+		extra[k] = compactJSON(v)
+	}
+	return keys, extra
+}
+
+// compactJSON returns v without insignificant white space
+func compactJSON(v json.RawMessage) json.RawMessage {
+	var buf bytes.Buffer
+	if json.Compact(&buf, v) != nil {
+		return v
+	}
+	return buf.Bytes()
+}
+
+// emptyJSON reports whether v is null, false, zero, empty or an object or
+// array of nothing but empty values, i.e. what an unset field encodes to
+func emptyJSON(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return len(v) == 0
+	case []interface{}:
+		for _, e := range v {
+			if !emptyJSON(e) {
+				return false
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			if !emptyJSON(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// withFields adds the fields to the JSON object in data. Fields already in
+// the object are left alone. Unless keys is nil, empty fields missing from
+// keys, the keys the object was decoded from, are dropped again.
+func withFields(data []byte, keys map[string]bool, fields ...map[string]json.RawMessage) ([]byte, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, m := range fields {
+		for k, v := range m {
+			if _, ok := all[k]; !ok {
+				all[k] = v
+				changed = true
+			}
+		}
+	}
+	if keys != nil {
+		for k, v := range all {
+			var value interface{}
+			if !keys[k] && json.Unmarshal(v, &value) == nil && emptyJSON(value) {
+				delete(all, k)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(all)
+}
+
+// UnmarshalJSON decodes the event, keeping unknown top level fields in
+// Extra
+func (e *JIRAWebevent) UnmarshalJSON(data []byte) error {
+	type event JIRAWebevent
+	// Carry on past mistyped fields like json.Unmarshal does
+	err := json.Unmarshal(data, (*event)(e))
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return err
+	}
+	e.keys_, e.Extra = decodeObject(data, webeventNames)
+	return err
+}
+
+// MarshalJSON encodes the event along with the unknown fields it was
+// decoded with, so parsed events encode to the payload they came from
+func (e JIRAWebevent) MarshalJSON() ([]byte, error) {
+	type event JIRAWebevent
+	data, err := json.Marshal(event(e))
+	if err != nil {
+		return nil, err
+	}
+	return withFields(data, e.keys_, e.Extra)
+}
+
+// UnmarshalJSON decodes the issue, keeping its unknown fields
+func (i *JIRAIssue) UnmarshalJSON(data []byte) error {
+	type issue JIRAIssue
+	err := json.Unmarshal(data, (*issue)(i))
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return err
+	}
+	i.keys_, i.extra_ = decodeObject(data, issueNames)
+	return err
+}
+
+// MarshalJSON encodes the issue along with the unknown fields it was
+// decoded with
+func (i JIRAIssue) MarshalJSON() ([]byte, error) {
+	type issue JIRAIssue
+	data, err := json.Marshal(issue(i))
+	if err != nil {
+		return nil, err
+	}
+	return withFields(data, i.keys_, i.extra_)
+}
+
+// UnmarshalJSON decodes the change, keeping its unknown fields
+func (c *ChangleLogItems) UnmarshalJSON(data []byte) error {
+	type item ChangleLogItems
+	err := json.Unmarshal(data, (*item)(c))
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return err
+	}
+	c.keys_, c.extra_ = decodeObject(data, changeItemNames)
+	return err
+}
+
+// MarshalJSON encodes the change along with the unknown fields it was
+// decoded with
+func (c ChangleLogItems) MarshalJSON() ([]byte, error) {
+	type item ChangleLogItems
+	data, err := json.Marshal(item(c))
+	if err != nil {
+		return nil, err
+	}
+	return withFields(data, c.keys_, c.extra_)
+}
+
+// MarshalJSON encodes the fields along with every custom field and the
+// other fields they were decoded with
+func (f IssueFieldData) MarshalJSON() ([]byte, error) {
+	type fields IssueFieldData
+	data, err := json.Marshal(fields(f))
+	if err != nil {
+		return nil, err
+	}
+
+	// Custom fields filled in by hand only have their string values
+	custom := make(map[string]json.RawMessage, len(f.CustomFields))
+	for k, v := range f.CustomFields {
+		if _, ok := f.custom_[k]; ok {
+			continue
+		}
+		if json.Valid([]byte(v)) {
+			custom[k] = json.RawMessage(v)
+		} else {
+			custom[k], _ = json.Marshal(v)
+		}
+	}
+	return withFields(data, f.keys_, f.custom_, custom, f.extra_)
+}
+
+// Bytes returns the payload the event was parsed from or, for events
+// built by hand, the event encoded as JSON
+func (e *JIRAWebevent) Bytes() ([]byte, error) {
+	if len(e.Raw) > 0 {
+		return e.Raw, nil
+	}
+	return json.Marshal(e)
+}
+
+// Replay parses an archived payload and renders it exactly as if it was
+// just received with dispatch, e.g. SlackService.Dispatch or a function
+// calling Dispatch with your own Slacker
+func Replay(dispatch func(*JIRAWebevent) error, payload []byte) error {
+	event, err := ParseBytes(payload)
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return err
+	}
+	return dispatch(&event)
+}
@@ -0,0 +1,128 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testPayload = `{
+	"timestamp": 1451901600000,
+	"webhookEvent": "jira:issue_updated",
+	"issue_event_type_name": "issue_generic",
+	"user": {"name": "mmcfly", "displayName": "Marty McFly", "timeZone": "Europe/Berlin",
+		"groups": {"size": 1, "items": [{"name": "jira-users"}]}},
+	"issue": {
+		"id": "10001",
+		"key": "PROJ-1",
+		"fields": {
+			"summary": "Fix it",
+			"created": "2016-01-04T10:00:00.000+0000",
+			"issuetype": {"id": "5", "name": "Sub-task", "subtask": true},
+			"votes": {"votes": 2, "hasVoted": false},
+			"customfield_10002": 5.5,
+			"customfield_10003": "text"
+		}
+	},
+	"comment": {"id": "7", "body": "Done", "jsdPublic": true},
+	"changelog": {"id": "1", "items": [{"field": "status", "fieldId": "status", "fromString": "Open", "toString": "Done"}]}
+}`
+
+func TestRoundTrip(t *testing.T) {
+	event, err := ParseBytes([]byte(testPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.Issue.Fields.IssueType.Subtask {
+		t.Error("subtask not decoded")
+	}
+
+	// The payload is archived as received, unknown fields and all
+	data, err := event.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got interface{}
+	json.Unmarshal([]byte(testPayload), &want)
+	json.Unmarshal(data, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("payload changed\noriginal %s\narchived %s", testPayload, data)
+	}
+
+	// Events re-parsed from the archive are the same
+	again, err := ParseBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, event) {
+		t.Errorf("re-parsed event differs\n%+v\n%+v", again, event)
+	}
+
+	// Events built by hand are encoded with their custom fields
+	event.Raw = nil
+	event.Issue.Fields.CustomFields["customfield_10004"] = "typed"
+	if data, err = event.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if again, err = ParseBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range event.Issue.Fields.CustomFields {
+		if again.Issue.Fields.CustomFields[k] != v {
+			t.Errorf("%s = %q, want %q", k, again.Issue.Fields.CustomFields[k], v)
+		}
+	}
+}
+
+// Payload with fields this library doesn't know at the top level, in the
+// issue and its fields and in the changelog items
+const unknownPayload = `{
+	"timestamp": 1451901600000,
+	"webhookEvent": "jira:issue_updated",
+	"issue_event_type_name": "issue_generic",
+	"matchedWebhookIds": [1, 2],
+	"issue": {
+		"id": "10001",
+		"key": "PROJ-1",
+		"renderedFields": {"summary": "Fix it"},
+		"fields": {
+			"summary": "Fix it",
+			"created": "2016-01-04T10:00:00.000+0000",
+			"statuscategorychangedate": "2016-01-05T10:00:00.000+0000",
+			"customfield_10002": 5.5
+		}
+	},
+	"changelog": {"id": "1", "items": [{"field": "status", "fieldtype": "jira", "fieldId": "status",
+		"from": "1", "fromString": "Open", "to": "3", "toString": "Done", "tmpFromAccountId": null}]}
+}`
+
+func TestMarshalUnknownFields(t *testing.T) {
+	var event JIRAWebevent
+	if err := json.Unmarshal([]byte(unknownPayload), &event); err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Extra) != 2 {
+		t.Errorf("extra = %v, want issue_event_type_name and matchedWebhookIds", event.Extra)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got interface{}
+	json.Unmarshal([]byte(unknownPayload), &want)
+	json.Unmarshal(data, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("payload changed\noriginal %s\nencoded  %s", unknownPayload, data)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := &recordingEventSlacker{}
+	if err := Replay(dispatcher(s), []byte(testPayload)); err != nil {
+		t.Fatal(err)
+	}
+	if s.called != "IssueUpdated" {
+		t.Errorf("called %s, want IssueUpdated", s.called)
+	}
+}
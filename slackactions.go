@@ -0,0 +1,343 @@
+package jirachat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callback id of the attachments carrying issue actions
+const slackActionCallback = "jira_issue"
+
+// Names of the buttons added to issue messages
+const (
+	ActionAssignSelf = "assign_self"
+	ActionTransition = "transition"
+)
+
+var ErrSlackSignature = errors.New("invalid Slack request signature")
+
+// Action is a button on an Attachment.
+// See - https://api.slack.com/docs/message-buttons
+type Action struct {
+	Name  string `json:"name"`
+	Text  string `json:"text"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+
+	// Either default, primary or danger
+	// Optional
+	Style string `json:"style,omitempty"`
+}
+
+// SlackUser identifies the Slack user behind an interaction
+type SlackUser struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// SlackInteraction is the payload Slack sends when a user clicks a button
+// on an interactive message.
+// See - https://api.slack.com/docs/interactive-message-field-guide
+type SlackInteraction struct {
+	Type        string    `json:"type"`
+	CallbackId  string    `json:"callback_id"`
+	Actions     []Action  `json:"actions"`
+	User        SlackUser `json:"user"`
+	ResponseUrl string    `json:"response_url"`
+}
+
+// SlackCommandResponse is the reply to a slash command or interaction
+type SlackCommandResponse struct {
+	// Either ephemeral or in_channel
+	ResponseType    string `json:"response_type,omitempty"`
+	Text            string `json:"text"`
+	ReplaceOriginal bool   `json:"replace_original"`
+}
+
+// Configuration used by SlackActionHandler
+type SlackActionConfig struct {
+	// Signing secret of your Slack app, used to verify requests.
+	// Required, requests are refused without it.
+	SigningSecret string
+
+	// JIRA instance the actions are performed on. The credentials are
+	// those of the user acting on behalf of Slack users.
+	JIRA *JIRAConfig
+
+	// Optional mapping from a Slack user to the JIRA user issues are
+	// assigned to and preferences are recorded for: the user name on JIRA
+	// Server or the account id on JIRA Cloud. Defaults to the Slack user
+	// name on Server and to the account id of the only JIRA user matching
+	// it on Cloud.
+	JIRAUser func(user SlackUser) (string, error)
+
+	// Optional store of personal notification preferences, enables the
+	// mute and unmute commands
+	Preferences PreferenceStore
+}
+
+// SlackActionHandler serves the /jira slash command and the buttons on
+// issue messages, writing the changes back to JIRA.
+//
+// The slash command accepts:
+//
+//	/jira assign PROJ-123
+//	/jira transition PROJ-123 In Progress
+//	/jira comment PROJ-123 Looks good to me
+//	/jira mute assigned|comment|watching|all
+//	/jira unmute assigned|comment|watching|all
+type SlackActionHandler struct {
+	Config *SlackActionConfig
+}
+
+// Create a new handler for Slack slash commands and interactive messages
+func NewSlackActionHandler(config *SlackActionConfig) *SlackActionHandler {
+	return &SlackActionHandler{Config: config}
+}
+
+// Returns an error if the configuration is missing required values
+func (c *SlackActionConfig) IsValid() error {
+	if len(c.SigningSecret) == 0 {
+		return errors.New("Invalid Slack signing secret")
+	}
+	if c.JIRA == nil {
+		return errors.New("Missing JIRA config")
+	}
+	return c.JIRA.IsValid()
+}
+
+// VerifySlackRequest checks the signature Slack attaches to every request
+// made to your app. Requests older than five minutes are rejected, as
+// is every request when the secret is empty.
+//
+// Slack API docs: https://api.slack.com/authentication/verifying-requests-from-slack
+func VerifySlackRequest(r *http.Request, body []byte, secret string) error {
+	// Anyone can sign with an empty key
+	if len(secret) == 0 {
+		return ErrSlackSignature
+	}
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	sent, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrSlackSignature
+	}
+	if age := time.Since(time.Unix(sent, 0)); age > 5*time.Minute || age < -5*time.Minute {
+		return ErrSlackSignature
+	}
+
+	sig := r.Header.Get("X-Slack-Signature")
+	if !hmac.Equal([]byte(sig), []byte(SignSlackRequest(secret, ts, body))) {
+		return ErrSlackSignature
+	}
+	return nil
+}
+
+// SignSlackRequest returns the X-Slack-Signature of body sent at ts
+func SignSlackRequest(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *SlackActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.Config.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := VerifySlackRequest(r, body, h.Config.SigningSecret); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	client, err := NewJIRAClient(r, h.Config.JIRA)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var text string
+	switch {
+	case len(form.Get("payload")) > 0:
+		var interaction SlackInteraction
+		if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		text = h.interaction(client, &interaction)
+	case len(form.Get("command")) > 0:
+		user := SlackUser{Id: form.Get("user_id"), Name: form.Get("user_name")}
+		text = h.command(client, user, form.Get("text"))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&SlackCommandResponse{
+		ResponseType: "ephemeral",
+		Text:         text,
+	})
+}
+
+// command runs a slash command and returns the reply shown to the user
+func (h *SlackActionHandler) command(client *JIRAClient, user SlackUser, text string) string {
+	args := strings.Fields(text)
+	if len(args) < 2 {
+		return commandUsage
+	}
+	cmd := strings.ToLower(args[0])
+	key := strings.ToUpper(args[1])
+	rest := strings.Join(args[2:], " ")
+
+	switch cmd {
+	case "mute", "unmute":
+		return h.mute(client, user, cmd == "mute", strings.ToLower(args[1]))
+	case "assign":
+		return h.assignSelf(client, user, key)
+	case "transition", "move":
+		if len(rest) == 0 {
+			return commandUsage
+		}
+		return h.transition(client, key, rest)
+	case "comment":
+		if len(rest) == 0 {
+			return commandUsage
+		}
+		comment := fmt.Sprintf("%s (via Slack): %s", user.Name, rest)
+		if _, err := client.AddComment(key, comment); err != nil {
+			return fmt.Sprintf("Could not comment on %s: %v", key, err)
+		}
+		return fmt.Sprintf("Commented on %s", key)
+	}
+	return commandUsage
+}
+
+const commandUsage = "Usage: /jira assign KEY | /jira transition KEY STATUS | " +
+	"/jira comment KEY TEXT | /jira mute|unmute assigned|comment|watching|all"
+
+// interaction runs the button clicked on an issue message
+func (h *SlackActionHandler) interaction(client *JIRAClient, in *SlackInteraction) string {
+	if in.CallbackId != slackActionCallback || len(in.Actions) == 0 {
+		return "Unknown action"
+	}
+
+	action := in.Actions[0]
+	switch action.Name {
+	case ActionAssignSelf:
+		return h.assignSelf(client, in.User, action.Value)
+	case ActionTransition:
+		parts := strings.SplitN(action.Value, "|", 2)
+		if len(parts) != 2 {
+			return "Unknown action"
+		}
+		return h.transition(client, parts[0], parts[1])
+	}
+	return "Unknown action"
+}
+
+// mute records the user's opt out of a kind of personal notification
+func (h *SlackActionHandler) mute(client *JIRAClient, user SlackUser, optOut bool, kind string) string {
+	if h.Config.Preferences == nil {
+		return commandUsage
+	}
+	switch kind {
+	case NotifyAssigned, NotifyComment, NotifyWatching, NotifyAll:
+	default:
+		return commandUsage
+	}
+
+	id, err := h.jiraUser(client, user)
+	if err != nil {
+		return fmt.Sprintf("Could not find your JIRA user: %v", err)
+	}
+	if err := h.Config.Preferences.SetOptOut(id, kind, optOut); err != nil {
+		return fmt.Sprintf("Could not save your preferences: %v", err)
+	}
+	if optOut {
+		return fmt.Sprintf("Muted %s notifications", kind)
+	}
+	return fmt.Sprintf("Unmuted %s notifications", kind)
+}
+
+// jiraUser returns the JIRA user name, or account id on JIRA Cloud, of
+// the Slack user
+func (h *SlackActionHandler) jiraUser(client *JIRAClient, user SlackUser) (string, error) {
+	if h.Config.JIRAUser != nil {
+		return h.Config.JIRAUser(user)
+	}
+	if client.Config.Server {
+		return user.Name, nil
+	}
+	users, err := client.FindUsers(user.Name)
+	if err != nil {
+		return "", err
+	}
+	if len(users) != 1 {
+		return "", fmt.Errorf("%d JIRA users match %s", len(users), user.Name)
+	}
+	return users[0].AccountId, nil
+}
+
+func (h *SlackActionHandler) assignSelf(client *JIRAClient, user SlackUser, key string) string {
+	id, err := h.jiraUser(client, user)
+	if err != nil {
+		return fmt.Sprintf("Could not find your JIRA user: %v", err)
+	}
+	if err := client.AssignIssue(key, id); err != nil {
+		return fmt.Sprintf("Could not assign %s: %v", key, err)
+	}
+	return fmt.Sprintf("Assigned %s to you", key)
+}
+
+func (h *SlackActionHandler) transition(client *JIRAClient, key, status string) string {
+	if err := client.TransitionIssue(key, status); err != nil {
+		return fmt.Sprintf("Could not move %s to %s: %v", key, status, err)
+	}
+	return fmt.Sprintf("Moved %s to %s", key, status)
+}
+
+// addIssueActions adds the assign and transition buttons to the
+// attachment when the config enables them
+func (c *SlackConfig) addIssueActions(a *Attachment, key string) {
+	if !c.Interactive {
+		return
+	}
+
+	a.CallbackId = slackActionCallback
+	a.Actions = []Action{{
+		Name:  ActionAssignSelf,
+		Text:  "Assign to me",
+		Type:  "button",
+		Value: key,
+	}}
+	for _, status := range c.Transitions {
+		a.Actions = append(a.Actions, Action{
+			Name:  ActionTransition,
+			Text:  status,
+			Type:  "button",
+			Value: key + "|" + status,
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJIRA records the REST calls made to it
+type fakeJIRA struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string
+	body  map[string]string
+}
+
+func newFakeJIRA(t *testing.T) *fakeJIRA {
+	f := &fakeJIRA{body: make(map[string]string)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		call := r.Method + " " + r.URL.Path
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		f.body[call] = string(body)
+		f.mu.Unlock()
+
+		switch call {
+		case "GET /rest/api/2/issue/PROJ-1/transitions":
+			w.Write([]byte(`{"transitions":[
+				{"id":"11","name":"Start Progress","to":{"name":"In Progress"}},
+				{"id":"31","name":"Resolve","to":{"name":"Done"}}]}`))
+		case "POST /rest/api/2/issue/PROJ-1/comment":
+			w.Write([]byte(`{"id":"100"}`))
+		case "GET /rest/api/2/user/search":
+			if r.URL.Query().Get("query") == "mmcfly" {
+				w.Write([]byte(`[{"accountId":"557058:abc","displayName":"Marty McFly"}]`))
+			} else {
+				w.Write([]byte(`[]`))
+			}
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeJIRA) lastBody(call string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.body[call]
+}
+
+// slackPost builds a request signed the way Slack signs them
+func slackPost(secret string, form url.Values) *http.Request {
+	body := form.Encode()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest("POST", "/slack/actions", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", SignSlackRequest(secret, ts, []byte(body)))
+	return r
+}
+
+func testActionHandler(jira *fakeJIRA) *SlackActionHandler {
+	return NewSlackActionHandler(&SlackActionConfig{
+		SigningSecret: "shh",
+		JIRA: &JIRAConfig{
+			BaseUrl:  jira.URL,
+			Username: "bot",
+			Token:    "secret",
+		},
+	})
+}
+
+func serveAction(t *testing.T, h http.Handler, r *http.Request) SlackCommandResponse {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp SlackCommandResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestSlashCommandAssign(t *testing.T) {
+	jira := newFakeJIRA(t)
+	for _, server := range []bool{false, true} {
+		h := testActionHandler(jira)
+		h.Config.JIRA.Server = server
+
+		resp := serveAction(t, h, slackPost("shh", url.Values{
+			"command":   {"/jira"},
+			"text":      {"assign proj-1"},
+			"user_id":   {"U1"},
+			"user_name": {"mmcfly"},
+		}))
+
+		if resp.Text != "Assigned PROJ-1 to you" {
+			t.Errorf("server %v: Text = %q", server, resp.Text)
+		}
+		body := strings.TrimSpace(jira.lastBody("PUT /rest/api/2/issue/PROJ-1/assignee"))
+		want := `{"accountId":"557058:abc"}`
+		if server {
+			want = `{"name":"mmcfly"}`
+		}
+		if body != want {
+			t.Errorf("server %v: assignee body = %q, want %q", server, body, want)
+		}
+	}
+
+	// Cloud users must match a single JIRA user
+	resp := serveAction(t, testActionHandler(jira), slackPost("shh", url.Values{
+		"command":   {"/jira"},
+		"text":      {"assign proj-1"},
+		"user_id":   {"U2"},
+		"user_name": {"dbrown"},
+	}))
+	if !strings.HasPrefix(resp.Text, "Could not find your JIRA user") {
+		t.Errorf("Text = %q", resp.Text)
+	}
+}
+
+func TestSlashCommandComment(t *testing.T) {
+	jira := newFakeJIRA(t)
+	h := testActionHandler(jira)
+
+	resp := serveAction(t, h, slackPost("shh", url.Values{
+		"command":   {"/jira"},
+		"text":      {"comment PROJ-1 Looks good"},
+		"user_name": {"mmcfly"},
+	}))
+
+	if resp.Text != "Commented on PROJ-1" {
+		t.Errorf("Text = %q", resp.Text)
+	}
+	body := jira.lastBody("POST /rest/api/2/issue/PROJ-1/comment")
+	if !strings.Contains(body, "Looks good") {
+		t.Errorf("comment body = %q", body)
+	}
+}
+
+func TestButtonTransition(t *testing.T) {
+	jira := newFakeJIRA(t)
+	h := testActionHandler(jira)
+
+	var attachment Attachment
+	config := &SlackConfig{Interactive: true, Transitions: []string{"Done"}}
+	config.addIssueActions(&attachment, "PROJ-1")
+
+	payload, _ := json.Marshal(SlackInteraction{
+		Type:       "interactive_message",
+		CallbackId: attachment.CallbackId,
+		Actions:    attachment.Actions[1:],
+		User:       SlackUser{Id: "U1", Name: "mmcfly"},
+	})
+	resp := serveAction(t, h, slackPost("shh", url.Values{
+		"payload": {string(payload)},
+	}))
+
+	if resp.Text != "Moved PROJ-1 to Done" {
+		t.Errorf("Text = %q", resp.Text)
+	}
+	body := jira.lastBody("POST /rest/api/2/issue/PROJ-1/transitions")
+	if !strings.Contains(body, `"id":"31"`) {
+		t.Errorf("transition body = %q", body)
+	}
+}
+
+func TestSlackActionBadSignature(t *testing.T) {
+	jira := newFakeJIRA(t)
+	h := testActionHandler(jira)
+
+	r := slackPost("wrong secret", url.Values{
+		"command": {"/jira"},
+		"text":    {"assign PROJ-1"},
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if len(jira.calls) != 0 {
+		t.Errorf("JIRA was called: %v", jira.calls)
+	}
+}
+
+func TestSlackActionMissingSecret(t *testing.T) {
+	jira := newFakeJIRA(t)
+	h := testActionHandler(jira)
+	h.Config.SigningSecret = ""
+
+	// Signed with the empty key, as anyone could
+	r := slackPost("", url.Values{
+		"command": {"/jira"},
+		"text":    {"assign PROJ-1"},
+	})
+	if err := VerifySlackRequest(r, []byte(url.Values{
+		"command": {"/jira"},
+		"text":    {"assign PROJ-1"},
+	}.Encode()), ""); err != ErrSlackSignature {
+		t.Errorf("VerifySlackRequest with empty secret = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code == http.StatusOK {
+		t.Error("request served without a signing secret")
+	}
+	if len(jira.calls) != 0 {
+		t.Errorf("JIRA was called: %v", jira.calls)
+	}
+}
+
+func TestSlackActionConcurrent(t *testing.T) {
+	jira := newFakeJIRA(t)
+	h := testActionHandler(jira)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, slackPost("shh", url.Values{
+				"command":   {"/jira"},
+				"text":      {"assign PROJ-1"},
+				"user_name": {"mmcfly"},
+			}))
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	assigned := 0
+	for _, call := range jira.calls {
+		if call == "PUT /rest/api/2/issue/PROJ-1/assignee" {
+			assigned++
+		}
+	}
+	if assigned != 4 {
+		t.Errorf("JIRA calls = %v", jira.calls)
+	}
+}
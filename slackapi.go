@@ -0,0 +1,352 @@
+package jirachat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Base Slack Web API URL
+//
+// https://api.slack.com/web
+const defaultSlackApiUrl = "https://slack.com/api/"
+
+// SlackResponse is the common part of every Slack Web API response
+type SlackResponse struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Ts      string `json:"ts,omitempty"`
+}
+
+// SlackError is a Web API response that is not ok
+type SlackError struct {
+	Method string
+
+	// Error code returned by Slack, e.g. channel_not_found
+	Code string
+}
+
+func (e *SlackError) Error() string {
+	return "Slack " + e.Method + " failed: " + e.Code
+}
+
+// SlackThread identifies the message at the root of an issue's thread
+type SlackThread struct {
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+
+	// Changelog of the issue shown on its message when updating
+	// messages in place
+	Changelog []string `json:"changelog,omitempty"`
+}
+
+// ThreadStore remembers the thread started for each issue key. Implement
+// it on top of your datastore of choice when running more than one
+// instance.
+type ThreadStore interface {
+	// GetThread returns the thread for the issue key or nil if there
+	// is none yet
+	GetThread(key string) (*SlackThread, error)
+
+	// PutThread records the thread for the issue key
+	PutThread(key string, thread *SlackThread) error
+}
+
+// MemoryThreadStore is a ThreadStore kept in process memory
+type MemoryThreadStore struct {
+	mu      sync.Mutex
+	threads map[string]SlackThread
+}
+
+// Create a new, empty, in memory ThreadStore
+func NewMemoryThreadStore() *MemoryThreadStore {
+	return &MemoryThreadStore{threads: make(map[string]SlackThread)}
+}
+
+func (m *MemoryThreadStore) GetThread(key string) (*SlackThread, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	thread, ok := m.threads[key]
+	if !ok {
+		return nil, nil
+	}
+	return &thread, nil
+}
+
+func (m *MemoryThreadStore) PutThread(key string, thread *SlackThread) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.threads[key] = *thread
+	return nil
+}
+
+// apiCall posts body as JSON to the Slack Web API method and decodes the
+// response into v. Methods which do not accept JSON are sent url.Values
+// as a form instead. A response that is not ok is returned as a
+// *SlackError.
+func (c *SlackConfig) apiCall(method string, body interface{}, v interface{}) (*SlackResponse, error) {
+	if c.DryRun != nil {
+		return c.dryRunCall(method, body)
+	}
+	base := c.ApiUrl
+	if len(base) == 0 {
+		base = defaultSlackApiUrl
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	contentType := "application/json; charset=utf-8"
+	var data []byte
+	if form, ok := body.(url.Values); ok {
+		contentType = "application/x-www-form-urlencoded"
+		data = []byte(form.Encode())
+	} else {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest("POST", base+method, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || code > 299 {
+		return nil, fmt.Errorf("Slack %s returns status %d", method, code)
+	}
+
+	// Decode the whole body twice, once for the common fields and once
+	// for the method specific ones
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	sr := new(SlackResponse)
+	if err := json.Unmarshal(raw, sr); err != nil {
+		return nil, err
+	}
+	if !sr.Ok {
+		return sr, &SlackError{Method: method, Code: sr.Error}
+	}
+	if v != nil {
+		if err := json.Unmarshal(raw, v); err != nil {
+			return sr, err
+		}
+	}
+	return sr, nil
+}
+
+// PostMessage sends the SlackMessage with the Web API chat.postMessage
+// method. Unlike SendEvent it requires a bot token but can post
+// replies to threads.
+//
+// Slack API docs: https://api.slack.com/methods/chat.postMessage
+func (p *SlackMessage) PostMessage(config *SlackConfig) (*SlackResponse, error) {
+	resp, err := config.apiCall("chat.postMessage", p, nil)
+	if err != nil {
+		SendErrorNotice(fmt.Sprintf("%v", err), config)
+	}
+	return resp, err
+}
+
+// threads returns the configured ThreadStore or the config's own one
+func (c *SlackConfig) threads() ThreadStore {
+	if c.Threads != nil {
+		return c.Threads
+	}
+	return c.threads_
+}
+
+// send delivers the payload for the event, truncated to fit Slack's
+// limits, with the age of late events in the fallback texts. Without a
+// bot token this is the same as SendEvent. With a token the first message
+// about an issue starts a thread and, when reply is set, later messages
+// are posted to that thread. Events about anything but an issue go to the
+// channel.
+func (s *SlackService) send(event *JIRAWebevent, payload *SlackMessage, reply bool) error {
+	payload.truncate(event, s.Config.Domain)
+	age := event.age()
+	for i := range payload.Attachments {
+		a := &payload.Attachments[i]
+		if a.Ts == 0 && !event.Timestamp.IsZero() {
+			a.Ts = event.Timestamp.Unix()
+		}
+		if len(a.Fallback) > 0 {
+			a.Fallback += age
+		}
+	}
+	if len(s.Config.Token) == 0 {
+		return payload.SendEvent(s.Config)
+	}
+
+	key := event.Issue.Key
+	store := s.Config.threads()
+	thread, err := store.GetThread(key)
+	if err != nil {
+		return err
+	}
+
+	if s.Config.inPlace() && len(key) > 0 {
+		return s.update(event, payload, thread)
+	}
+
+	if thread != nil && reply {
+		payload.Channel = thread.Channel
+		payload.ThreadTs = thread.Ts
+		payload.ReplyBroadcast = s.Config.BroadcastStatus &&
+			event.hasChange("status")
+	}
+
+	resp, err := payload.PostMessage(s.Config)
+	if err != nil {
+		return err
+	}
+
+	if thread == nil && len(key) > 0 {
+		return store.PutThread(key, &SlackThread{
+			Channel: resp.Channel,
+			Ts:      resp.Ts,
+		})
+	}
+	return nil
+}
+
+// UpdateMessage replaces the message identified by ts with the
+// SlackMessage using the Web API chat.update method.
+//
+// Slack API docs: https://api.slack.com/methods/chat.update
+func (p *SlackMessage) UpdateMessage(config *SlackConfig, ts string) (*SlackResponse, error) {
+	body := struct {
+		*SlackMessage
+		Ts string `json:"ts"`
+	}{p, ts}
+	resp, err := config.apiCall("chat.update", &body, nil)
+	if err != nil {
+		SendErrorNotice(fmt.Sprintf("%v", err), config)
+	}
+	return resp, err
+}
+
+// Number of changelog entries kept on messages updated in place
+const maxLivingChangelog = 20
+
+// update keeps a single message per issue which shows the current state
+// of the issue. The title of the rendered payload is added to the
+// changelog of the message.
+func (s *SlackService) update(event *JIRAWebevent, payload *SlackMessage, thread *SlackThread) error {
+	if thread == nil {
+		thread = &SlackThread{}
+	}
+	if len(payload.Attachments) > 0 {
+		entry := payload.Attachments[0].Pretext
+		if !event.Timestamp.IsZero() {
+			entry = event.Timestamp.SlackDate("{date_short} {time}") + " " + entry
+		}
+		thread.Changelog = append(thread.Changelog, entry)
+	}
+	if n := len(thread.Changelog); n > maxLivingChangelog {
+		thread.Changelog = thread.Changelog[n-maxLivingChangelog:]
+	}
+
+	deleted := event.WebhookEvent == EventIssueDeleted
+	living := s.livingMessage(event, thread.Changelog, deleted)
+
+	if len(thread.Ts) == 0 {
+		resp, err := living.PostMessage(s.Config)
+		if err != nil {
+			return err
+		}
+		thread.Channel = resp.Channel
+		thread.Ts = resp.Ts
+	} else {
+		living.Channel = thread.Channel
+		if _, err := living.UpdateMessage(s.Config, thread.Ts); err != nil {
+			return err
+		}
+	}
+	return s.Config.threads().PutThread(event.Issue.Key, thread)
+}
+
+// livingMessage renders the current state of the issue followed by its
+// changelog. Deleted issues are struck through.
+func (s *SlackService) livingMessage(event *JIRAWebevent, changelog []string, deleted bool) *SlackMessage {
+	strike := func(v string) string {
+		if deleted && len(v) > 0 {
+			return "~" + v + "~"
+		}
+		return v
+	}
+
+	fields := event.Issue.Fields
+	assignee := fields.Assignee.DisplayName
+	if len(assignee) == 0 {
+		assignee = "unassigned"
+	}
+
+	title := fmt.Sprintf("%s %s", event.GetIssueLink(s.Config), fields.Summary)
+	if deleted {
+		title = fmt.Sprintf("%s %s", event.Issue.Key, fields.Summary)
+	}
+	attachment := Attachment{
+		Fallback: title,
+		Pretext:  strike(title),
+		Color:    event.GetColor(s.Config),
+		Fields: []Field{
+			{Title: "Status", Value: strike(fields.Status.Name), Short: true},
+			{Title: "Assignee", Value: strike(assignee), Short: true},
+			{Title: "Priority", Value: strike(fields.Priority.Name), Short: true},
+			{Title: "Changelog", Value: strings.Join(changelog, "\n"), Short: false},
+		},
+		MrkdwnIn: []string{"pretext", "fields"},
+	}
+
+	return &SlackMessage{
+		Channel:      s.Config.Channel,
+		Username:     s.Config.BotName,
+		Unfurl_links: true,
+		Attachments:  []Attachment{attachment},
+	}
+}
+
+// inPlace returns true if issue messages are updated in place, which
+// needs a bot token
+func (c *SlackConfig) inPlace() bool {
+	return c.UpdateInPlace && len(c.Token) > 0
+}
+
+// changedFields returns the names of the fields in the changelog
+func (e *JIRAWebevent) changedFields() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, item := range e.Changelog.Items {
+		if !seen[item.Field] {
+			seen[item.Field] = true
+			names = append(names, item.Field)
+		}
+	}
+	return names
+}
+
+// hasChange returns true if the changelog contains the field
+func (e *JIRAWebevent) hasChange(field string) bool {
+	for _, item := range e.Changelog.Items {
+		if item.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package jirachat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+const threadCommentPayload = `{"webhookEvent": "comment_created",
+	"comment": {"id": "1", "body": "Great Scott!", "author": {"name": "dbrown", "displayName": "Emmett Brown"}},
+	"issue": {"key": "PROJ-1", "fields": {"summary": "Fix the flux capacitor"}}}`
+
+const threadStatusPayload = `{"webhookEvent": "jira:issue_updated",
+	"user": {"name": "dbrown", "displayName": "Emmett Brown"},
+	"issue": {"key": "PROJ-1", "fields": {"summary": "Fix the flux capacitor", "status": {"name": "Done"}}},
+	"changelog": {"items": [{"field": "status", "fromString": "Open", "toString": "Done"}]}}`
+
+// newSlackTest returns a service posting with a bot token to the fake
+// Slack
+func newSlackTest(slack *jirachattest.SlackServer, config *SlackConfig) *SlackService {
+	config.Domain = "example"
+	config.ApiUrl = slack.ApiURL()
+	config.Token = "xoxb-test"
+	return NewSlackService(nil, config)
+}
+
+// lastMessage decodes the last message received by the fake Slack
+func lastMessage(t *testing.T, slack *jirachattest.SlackServer) SlackMessage {
+	t.Helper()
+	msgs := slack.Messages()
+	var msg SlackMessage
+	if len(msgs) == 0 || msgs[len(msgs)-1].JSON(&msg) != nil {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	return msg
+}
+
+func TestThreads(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	svc := newSlackTest(slack, &SlackConfig{Channel: "C1", BroadcastStatus: true})
+
+	created := parseString(t, dryRunPayload)
+	if err := svc.IssueCreated(&created); err != nil {
+		t.Fatal(err)
+	}
+	if msg := lastMessage(t, slack); msg.ThreadTs != "" {
+		t.Errorf("first message in thread %q", msg.ThreadTs)
+	}
+	thread, err := svc.Config.threads().GetThread("PROJ-1")
+	if err != nil || thread == nil || thread.Channel != "C1" || thread.Ts != "1451901600.000001" {
+		t.Fatalf("thread = %+v, %v", thread, err)
+	}
+
+	comment := parseString(t, threadCommentPayload)
+	if err := svc.CommentCreated(&comment); err != nil {
+		t.Fatal(err)
+	}
+	if msg := lastMessage(t, slack); msg.ThreadTs != thread.Ts || msg.ReplyBroadcast {
+		t.Errorf("comment = thread %q, broadcast %v", msg.ThreadTs, msg.ReplyBroadcast)
+	}
+
+	status := parseString(t, threadStatusPayload)
+	if err := svc.IssueUpdated(&status); err != nil {
+		t.Fatal(err)
+	}
+	if msg := lastMessage(t, slack); msg.ThreadTs != thread.Ts || !msg.ReplyBroadcast {
+		t.Errorf("status change = thread %q, broadcast %v", msg.ThreadTs, msg.ReplyBroadcast)
+	}
+}
+
+func TestThreadsPerConfig(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	first := newSlackTest(slack, &SlackConfig{Channel: "C1"})
+	second := newSlackTest(slack, &SlackConfig{Channel: "C2"})
+
+	created := parseString(t, dryRunPayload)
+	if err := first.IssueCreated(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second config knows nothing of the first one's thread
+	comment := parseString(t, threadCommentPayload)
+	if err := second.CommentCreated(&comment); err != nil {
+		t.Fatal(err)
+	}
+	if msg := lastMessage(t, slack); msg.ThreadTs != "" || msg.Channel != "C2" {
+		t.Errorf("comment = channel %q, thread %q", msg.Channel, msg.ThreadTs)
+	}
+	thread, _ := second.Config.threads().GetThread("PROJ-1")
+	if thread == nil || thread.Ts != "1451901600.000002" {
+		t.Errorf("second thread = %+v", thread)
+	}
+}
+
+func TestUpdateInPlace(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	svc := newSlackTest(slack, &SlackConfig{Channel: "C1", UpdateInPlace: true})
+
+	created := parseString(t, dryRunPayload)
+	if err := svc.IssueCreated(&created); err != nil {
+		t.Fatal(err)
+	}
+	status := parseString(t, threadStatusPayload)
+	for i := 0; i < maxLivingChangelog+5; i++ {
+		if err := svc.IssueUpdated(&status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reqs := slack.Messages()
+	if len(reqs) != maxLivingChangelog+6 {
+		t.Fatalf("sent %d messages", len(reqs))
+	}
+	if reqs[0].Path != "/api/chat.postMessage" {
+		t.Errorf("first message sent with %s", reqs[0].Path)
+	}
+	for _, req := range reqs[1:] {
+		var body struct {
+			Channel string `json:"channel"`
+			Ts      string `json:"ts"`
+		}
+		if req.Path != "/api/chat.update" || req.JSON(&body) != nil ||
+			body.Channel != "C1" || body.Ts != "1451901600.000001" {
+			t.Fatalf("update = %s %s", req.Path, req.Body)
+		}
+	}
+
+	thread, _ := svc.Config.threads().GetThread("PROJ-1")
+	if thread == nil || len(thread.Changelog) != maxLivingChangelog {
+		t.Fatalf("thread = %+v", thread)
+	}
+	msg := lastMessage(t, slack)
+	fields := msg.Attachments[0].Fields
+	if fields[0].Value != "Done" || fields[3].Title != "Changelog" ||
+		strings.Count(fields[3].Value, "\n") != maxLivingChangelog-1 {
+		t.Errorf("fields = %+v", fields)
+	}
+}
+
+func TestUpdateInPlaceAnyChange(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	svc := newSlackTest(slack, &SlackConfig{Channel: "C1", UpdateInPlace: true})
+
+	created := parseString(t, dryRunPayload)
+	if err := svc.IssueCreated(&created); err != nil {
+		t.Fatal(err)
+	}
+	priority := parseString(t, `{"webhookEvent": "jira:issue_updated",
+		"user": {"name": "dbrown", "displayName": "Emmett Brown"},
+		"issue": {"key": "PROJ-1", "fields": {"summary": "Fix the flux capacitor", "priority": {"id": "1", "name": "Highest"}}},
+		"changelog": {"items": [{"field": "priority", "fromString": "High", "toString": "Highest"}]}}`)
+	if err := svc.IssueUpdated(&priority); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := slack.Messages()
+	if len(reqs) != 2 || reqs[1].Path != "/api/chat.update" {
+		t.Fatalf("messages = %+v", reqs)
+	}
+	fields := lastMessage(t, slack).Attachments[0].Fields
+	if fields[2].Value != "Highest" || !strings.Contains(fields[3].Value, "changed priority of") {
+		t.Errorf("fields = %+v", fields)
+	}
+}
+
+func TestLivingMessageDeleted(t *testing.T) {
+	svc := NewSlackService(nil, &SlackConfig{Channel: "C1", Domain: "example"})
+	event := parseString(t, dryRunPayload)
+
+	msg := svc.livingMessage(&event, []string{"created"}, false)
+	a := msg.Attachments[0]
+	if !strings.Contains(a.Pretext, "<https://example.atlassian.net/browse/PROJ-1|PROJ-1>") ||
+		a.Fields[0].Value != "Open" || a.Fields[1].Value != "unassigned" {
+		t.Errorf("living = %+v", a)
+	}
+
+	msg = svc.livingMessage(&event, []string{"created", "deleted"}, true)
+	a = msg.Attachments[0]
+	if a.Pretext != "~PROJ-1 Fix the flux capacitor~" || a.Fields[0].Value != "~Open~" ||
+		a.Fields[2].Value != "~High~" || a.Fields[3].Value != "created\ndeleted" {
+		t.Errorf("deleted = %+v", a)
+	}
+}
+
+func TestUserLink(t *testing.T) {
+	config := &SlackConfig{Domain: "example"}
+	tests := []struct {
+		user JIRAUser
+		want string
+	}{
+		{JIRAUser{AccountId: "557058:abc", Name: "mmcfly", DisplayName: "Marty McFly"},
+			"<https://example.atlassian.net/jira/people/557058:abc|Marty McFly>"},
+		{JIRAUser{Name: "doc brown", DisplayName: "Emmett Brown"},
+			"<https://example.atlassian.net/secure/ViewProfile.jspa?name=doc+brown|Emmett Brown>"},
+		{JIRAUser{DisplayName: "Anonymous"}, "Anonymous"},
+	}
+	for _, tt := range tests {
+		event := &JIRAWebevent{User: tt.user, Comment: JIRAComment{Author: tt.user}}
+		if got := event.GetUserLink(config); got != tt.want {
+			t.Errorf("GetUserLink = %q, want %q", got, tt.want)
+		}
+		if got := event.Comment.GetUserLink(config); got != tt.want {
+			t.Errorf("comment GetUserLink = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package jirachat
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// notice delivers a message made of a single attachment
+func (s *SlackService) notice(event *JIRAWebevent, title, icon string, fields []Field, reply bool) error {
+	attachment := Attachment{
+		Fallback: title,
+		Pretext:  title,
+		Color:    event.GetColor(s.Config),
+		Fields:   fields,
+		MrkdwnIn: []string{"pretext", "fields"},
+	}
+
+	payload := SlackMessage{}
+	payload.Channel = s.Config.Channel
+	payload.Username = s.Config.BotName
+	payload.Icon_url = icon
+	payload.Unfurl_links = true
+	payload.Attachments = []Attachment{attachment}
+	return s.send(event, &payload, reply)
+}
+
+// userLink returns a markdown formatted link to the user's profile, by
+// account id on JIRA Cloud
+func (c *SlackConfig) userLink(user *JIRAUser) string {
+	var link string
+	switch {
+	case len(user.AccountId) > 0:
+		link = fmt.Sprintf(peopleLinkBase, c.Domain, url.PathEscape(user.AccountId))
+	case len(user.Name) > 0:
+		link = fmt.Sprintf(userLinkBase, c.Domain, url.QueryEscape(user.Name))
+	default:
+		return user.DisplayName
+	}
+	return fmt.Sprintf("<%s|%s>", link, user.DisplayName)
+}
+
+// issueRef links to the event's issue. Some events only carry the issue
+// id, which is used when the issue could not be fetched.
+func (s *SlackService) issueRef(event *JIRAWebevent, id string) string {
+	if len(event.Issue.Key) > 0 {
+		return event.GetIssueLink(s.Config)
+	}
+	return "issue " + id
+}
+
+// Default renderer for comment_updated and comment_deleted types
+func (s *SlackService) CommentChanged(event *JIRAWebevent) error {
+	s.enrich(event)
+	issue := event.GetIssueLink(s.Config)
+	fields := []Field{
+		{
+			Title: "Issue",
+			Value: event.Issue.Fields.Summary,
+			Short: false,
+		},
+	}
+
+	var title string
+	switch event.Action() {
+	case "updated":
+		editor := event.Comment.UpdateAuthor
+		if len(editor.DisplayName) == 0 {
+			editor = event.Comment.Author
+		}
+		title = fmt.Sprintf("%s edited a comment on %s",
+			s.Config.userLink(&editor), issue)
+		// Users mentioned have been pinged when the comment was made
+		body, _ := s.mentionComment(event.Comment.Body)
+		fields = append(fields, Field{
+			Title: "Comment",
+			Value: body,
+			Short: false,
+		})
+	case "deleted":
+		title = fmt.Sprintf("A comment by %s was deleted from %s",
+			s.Config.userLink(&event.Comment.Author), issue)
+	default:
+		return s.CommentCreated(event)
+	}
+	return s.notice(event, title, event.Comment.Author.LargeAvatar(), fields, true)
+}
+
+// Default renderer for worklog_created, worklog_updated and
+// worklog_deleted types
+func (s *SlackService) WorklogChanged(event *JIRAWebevent) error {
+	s.enrich(event)
+	sum := event.WorklogSummary()
+	author := s.Config.userLink(&sum.Author)
+	issue := s.issueRef(event, event.Worklog.IssueId)
+	logged := sum.LoggedText(durationFormat(s.Config.Durations))
+
+	var title string
+	switch event.Action() {
+	case "created":
+		title = fmt.Sprintf("%s logged %s on %s", author, logged, issue)
+	case "deleted":
+		title = fmt.Sprintf("A work log of %s by %s was deleted from %s",
+			logged, author, issue)
+	default:
+		title = fmt.Sprintf("%s updated a work log on %s", author, issue)
+	}
+	return s.notice(event, title, sum.Author.LargeAvatar(),
+		s.worklogFields(event, sum), true)
+}
+
+// Default renderer for issuelink_created and issuelink_deleted types.
+// System links, e.g. between an issue and its sub-tasks, are not posted.
+func (s *SlackService) IssueLinkChanged(event *JIRAWebevent) error {
+	link := &event.IssueLink
+	if link.SystemLink {
+		return nil
+	}
+
+	source := s.linkedIssue(link.SourceIssueId)
+	destination := s.linkedIssue(link.DestinationIssueId)
+	verb := link.IssueLinkType.OutwardName
+	if event.Action() == "deleted" {
+		verb = "no longer " + verb
+	}
+	title := fmt.Sprintf("%s %s %s", source, verb, destination)
+	return s.notice(event, title, event.User.LargeAvatar(), nil, false)
+}
+
+// linkedIssue links to the issue with the given id. Without access to the
+// JIRA REST API only the id is known.
+func (s *SlackService) linkedIssue(id int) string {
+	ref := strconv.Itoa(id)
+	if s.jira != nil {
+		if issue, err := s.jira.GetIssue(ref); err == nil {
+			link := fmt.Sprintf(issueLinkBase, s.Config.Domain, issue.Key)
+			return fmt.Sprintf("<%s|%s>", link, issue.Key)
+		}
+	}
+	return "issue " + ref
+}
+
+// Default renderer for sprint_* types. Started and closed sprints are
+// announced with their issue counts, see Announcement.
+func (s *SlackService) SprintChanged(event *JIRAWebevent) error {
+	switch event.Action() {
+	case "started", "closed":
+		return s.announce(event)
+	}
+
+	sprint := &event.Sprint
+	title := fmt.Sprintf("Sprint *%s* %s", sprint.Name, event.Action())
+
+	var fields []Field
+	if len(sprint.Goal) > 0 {
+		fields = append(fields, Field{
+			Title: "Goal",
+			Value: sprint.Goal,
+			Short: false,
+		})
+	}
+	if len(sprint.StartDate) > 0 {
+		fields = append(fields, Field{
+			Title: "Start",
+			Value: dateOnly(sprint.StartDate),
+			Short: true,
+		})
+	}
+	end := sprint.EndDate
+	if len(sprint.CompleteDate) > 0 {
+		end = sprint.CompleteDate
+	}
+	if len(end) > 0 {
+		fields = append(fields, Field{
+			Title: "End",
+			Value: dateOnly(end),
+			Short: true,
+		})
+	}
+	return s.notice(event, title, "", fields, false)
+}
+
+// Default renderer for jira:version_* types. Released versions are
+// announced with their resolved issues, see Announcement.
+func (s *SlackService) VersionChanged(event *JIRAWebevent) error {
+	if event.Action() == "released" {
+		return s.announce(event)
+	}
+
+	version := &event.Version
+	title := fmt.Sprintf("Version *%s* %s", version.Name, event.Action())
+
+	var fields []Field
+	if len(version.Description) > 0 {
+		fields = append(fields, Field{
+			Title: "Description",
+			Value: version.Description,
+			Short: false,
+		})
+	}
+	if len(version.ReleaseDate) > 0 {
+		fields = append(fields, Field{
+			Title: "Release Date",
+			Value: dateOnly(version.ReleaseDate),
+			Short: true,
+		})
+	}
+	return s.notice(event, title, "", fields, false)
+}
+
+// Default renderer for project_* types
+func (s *SlackService) ProjectChanged(event *JIRAWebevent) error {
+	project := &event.Project
+	name := project.Name
+	if event.Action() != "deleted" {
+		link := fmt.Sprintf(issueLinkBase, s.Config.Domain, project.Key)
+		name = fmt.Sprintf("<%s|%s>", link, project.Name)
+	}
+	title := fmt.Sprintf("Project %s %s", name, event.Action())
+
+	fields := []Field{
+		{
+			Title: "Key",
+			Value: project.Key,
+			Short: true,
+		},
+	}
+	if len(project.ProjectLead.DisplayName) > 0 {
+		fields = append(fields, Field{
+			Title: "Lead",
+			Value: s.Config.userLink(&project.ProjectLead),
+			Short: true,
+		})
+	}
+	return s.notice(event, title, project.AvatarUrls["48x48"], fields, false)
+}
+
+// Default renderer for user_* types
+func (s *SlackService) UserChanged(event *JIRAWebevent) error {
+	name := event.User.DisplayName
+	if len(name) == 0 {
+		name = event.User.Name
+	}
+	title := fmt.Sprintf("User %s %s", name, event.Action())
+	return s.notice(event, title, event.User.LargeAvatar(), nil, false)
+}
+
+// Default renderer for board_* types
+func (s *SlackService) BoardChanged(event *JIRAWebevent) error {
+	board := &event.Board
+	title := fmt.Sprintf("Board *%s* %s", board.Name, event.Action())
+
+	var fields []Field
+	if len(board.Type) > 0 {
+		fields = append(fields, Field{
+			Title: "Type",
+			Value: board.Type,
+			Short: true,
+		})
+	}
+	return s.notice(event, title, "", fields, false)
+}
+
+// Default renderer for attachment_created and attachment_deleted types
+func (s *SlackService) AttachmentChanged(event *JIRAWebevent) error {
+	attachment := &event.Attachment
+	author := s.Config.userLink(&attachment.Author)
+
+	var title string
+	if event.Action() == "deleted" {
+		title = fmt.Sprintf("Attachment %s was deleted", attachment.Filename)
+	} else {
+		title = fmt.Sprintf("%s attached <%s|%s>", author, attachment.Content,
+			attachment.Filename)
+	}
+	if len(event.Issue.Key) > 0 {
+		title += " on " + event.GetIssueLink(s.Config)
+	}
+
+	fields := []Field{
+		{
+			Title: "Type",
+			Value: attachment.MimeType,
+			Short: true,
+		},
+		{
+			Title: "Size",
+			Value: byteSize(attachment.Size),
+			Short: true,
+		},
+	}
+	return s.notice(event, title, attachment.Author.LargeAvatar(), fields, true)
+}
+
+// byteSize formats a file size, e.g. 1.5 MB
+func byteSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGT"[exp])
+}
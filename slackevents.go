@@ -0,0 +1,274 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+)
+
+// Most issues unfurled for a single message
+const maxUnfurls = 3
+
+// Matches issue keys such as JIRA-100 in chat messages
+var issueKeyPattern = regexp.MustCompile(`\b[A-Z][A-Z0-9_]+-[0-9]+\b`)
+
+// Configuration used by SlackEventHandler
+type SlackEventConfig struct {
+	// Signing secret of your Slack app, used to verify requests.
+	// Required, requests are refused without it.
+	SigningSecret string
+
+	// Slack configuration used to reply. Token is required.
+	Slack *SlackConfig
+
+	// JIRA instance issues are fetched from
+	JIRA *JIRAConfig
+
+	// Optional function running the work for an event once Slack's
+	// request is acknowledged, Slack gives up on requests taking more
+	// than three seconds. Defaults to a new goroutine. Runtimes which
+	// stop work when the response is sent, such as legacy App Engine,
+	// need to hand it to something else, e.g. a task queue.
+	Background func(work func())
+}
+
+// Returns an error if the configuration is missing required values
+func (c *SlackEventConfig) IsValid() error {
+	if len(c.SigningSecret) == 0 {
+		return errors.New("Invalid Slack signing secret")
+	}
+	if c.Slack == nil || (len(c.Slack.Token) == 0 && c.Slack.DryRun == nil) {
+		return errors.New("Invalid Slack token")
+	}
+	if c.JIRA == nil {
+		return errors.New("Missing JIRA config")
+	}
+	return c.JIRA.IsValid()
+}
+
+// SlackEventHandler serves the Slack Events API. Issue keys mentioned in
+// message events are answered in a thread with the issue details and
+// links to the JIRA domain in link_shared events are unfurled.
+//
+// Events are acknowledged before they are handled and failures are
+// reported to the Slack config's ErrChan rather than to Slack, so Slack
+// does not retry them. Retries of events are ignored.
+//
+// Slack API docs: https://api.slack.com/events-api
+type SlackEventHandler struct {
+	Config *SlackEventConfig
+}
+
+// Create a new handler for the Slack Events API
+func NewSlackEventHandler(config *SlackEventConfig) *SlackEventHandler {
+	return &SlackEventHandler{Config: config}
+}
+
+// SlackEventCallback is the envelope of every Events API request
+type SlackEventCallback struct {
+	Type      string     `json:"type"`
+	Challenge string     `json:"challenge,omitempty"`
+	Event     SlackEvent `json:"event"`
+}
+
+// SlackEvent is the subset of the message and link_shared events used
+// for unfurling
+type SlackEvent struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype,omitempty"`
+	Channel  string `json:"channel"`
+	User     string `json:"user,omitempty"`
+	BotId    string `json:"bot_id,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Ts       string `json:"ts,omitempty"`
+	ThreadTs string `json:"thread_ts,omitempty"`
+
+	// Set on link_shared events
+	MessageTs string       `json:"message_ts,omitempty"`
+	Links     []SharedLink `json:"links,omitempty"`
+}
+
+// SharedLink is a link posted in a message
+type SharedLink struct {
+	Domain string `json:"domain"`
+	URL    string `json:"url"`
+}
+
+func (h *SlackEventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.Config.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := VerifySlackRequest(r, body, h.Config.SigningSecret); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var callback SlackEventCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch callback.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(callback.Challenge))
+		return
+	case "event_callback":
+		// The first delivery was acknowledged, whatever became of it
+		if len(r.Header.Get("X-Slack-Retry-Num")) > 0 {
+			break
+		}
+		svc := NewSlackService(r, h.Config.Slack)
+		client, err := NewJIRAClient(r, h.Config.JIRA)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		event := callback.Event
+		h.background(func() {
+			if err := h.handleEvent(svc, client, &event); err != nil && len(svc.Config.ErrChan) > 0 {
+				svc.SendErrorNotice(fmt.Sprintf("Could not answer Slack %s event: %v",
+					event.Type, err), svc.Config)
+			}
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// background runs the work with the configured Background function
+func (h *SlackEventHandler) background(work func()) {
+	if h.Config.Background != nil {
+		h.Config.Background(work)
+		return
+	}
+	go work()
+}
+
+func (h *SlackEventHandler) handleEvent(svc *SlackService, client *JIRAClient, event *SlackEvent) error {
+	// Never answer ourselves or edits and other message subtypes
+	if len(event.BotId) > 0 || len(event.Subtype) > 0 {
+		return nil
+	}
+
+	switch event.Type {
+	case "message":
+		return h.replyToMessage(svc, client, event)
+	case "link_shared":
+		return h.unfurlLinks(svc, client, event)
+	}
+	return nil
+}
+
+// issueURLPattern matches links to issues on the configured JIRA instance
+func (h *SlackEventHandler) issueURLPattern() *regexp.Regexp {
+	base := h.Config.JIRA.siteURL() + "browse/"
+	return regexp.MustCompile(regexp.QuoteMeta(base) + `([A-Z][A-Z0-9_]+-[0-9]+)`)
+}
+
+// Links in Slack's message markup, e.g. <https://...|PROJ-1>
+var slackLinkPattern = regexp.MustCompile(`<[^>]*>`)
+
+// issueKeys returns the unique issue keys mentioned in the text. Links to
+// issues are left out, the link_shared event unfurls them.
+func (h *SlackEventHandler) issueKeys(text string) []string {
+	issueURL := h.issueURLPattern()
+	text = slackLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		if loc := issueURL.FindStringIndex(link); loc != nil && loc[0] == 1 {
+			return " "
+		}
+		return link
+	})
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range issueKeyPattern.FindAllString(text, -1) {
+		if !seen[key] && len(keys) < maxUnfurls {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// unfurlAttachment fetches the issue and renders it the same way as
+// IssueCreated does
+func unfurlAttachment(svc *SlackService, client *JIRAClient, key string) (*Attachment, error) {
+	issue, err := client.GetIssue(key)
+	if err != nil {
+		return nil, err
+	}
+	event := &JIRAWebevent{Issue: *issue}
+	title := fmt.Sprintf("%s %s", event.GetIssueLink(svc.Config),
+		issue.Fields.Status.Name)
+	attachment := svc.issueAttachment(event, title)
+	return &attachment, nil
+}
+
+// replyToMessage answers a message mentioning issues in its thread
+func (h *SlackEventHandler) replyToMessage(svc *SlackService, client *JIRAClient, event *SlackEvent) error {
+	var attachments []Attachment
+	for _, key := range h.issueKeys(event.Text) {
+		// Things that look like keys may not be issues at all
+		attachment, err := unfurlAttachment(svc, client, key)
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, *attachment)
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	thread := event.ThreadTs
+	if len(thread) == 0 {
+		thread = event.Ts
+	}
+	payload := SlackMessage{
+		Channel:     event.Channel,
+		Username:    svc.Config.BotName,
+		Attachments: attachments,
+		ThreadTs:    thread,
+	}
+	_, err := payload.PostMessage(svc.Config)
+	return err
+}
+
+// unfurlLinks unfurls every shared link to an issue
+//
+// Slack API docs: https://api.slack.com/methods/chat.unfurl
+func (h *SlackEventHandler) unfurlLinks(svc *SlackService, client *JIRAClient, event *SlackEvent) error {
+	pattern := h.issueURLPattern()
+	unfurls := make(map[string]Attachment)
+	for _, link := range event.Links {
+		m := pattern.FindStringSubmatch(link.URL)
+		if m == nil {
+			continue
+		}
+		attachment, err := unfurlAttachment(svc, client, m[1])
+		if err != nil {
+			continue
+		}
+		unfurls[link.URL] = *attachment
+	}
+	if len(unfurls) == 0 {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"channel": event.Channel,
+		"ts":      event.MessageTs,
+		"unfurls": unfurls,
+	}
+	_, err := svc.Config.apiCall("chat.unfurl", body, nil)
+	return err
+}
@@ -0,0 +1,172 @@
+package jirachat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+// eventPost builds an Events API request signed the way Slack signs them
+func eventPost(secret, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest("POST", "/slack/events", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", SignSlackRequest(secret, ts, []byte(body)))
+	return r
+}
+
+// newEventTest returns a handler answering from a fake JIRA knowing
+// PROJ-1 to a fake Slack. Events are handled before the response.
+func newEventTest(t *testing.T) (*SlackEventHandler, *jirachattest.SlackServer, string) {
+	jira, _ := newRESTServer(t, map[string]string{
+		"/rest/api/2/issue/PROJ-1?expand=names": `{"id": "10001", "key": "PROJ-1", "fields": {
+			"summary": "Fix the flux capacitor",
+			"status": {"name": "Open"},
+			"priority": {"id": "2", "name": "High"}}}`,
+	})
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	t.Cleanup(slack.Close)
+	h := NewSlackEventHandler(&SlackEventConfig{
+		SigningSecret: "shh",
+		Slack: &SlackConfig{
+			Domain: "example",
+			ApiUrl: slack.ApiURL(),
+			Token:  "xoxb-test",
+		},
+		JIRA:       &JIRAConfig{BaseUrl: jira.URL},
+		Background: func(work func()) { work() },
+	})
+	return h, slack, jira.URL
+}
+
+func serveEvent(t *testing.T, h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	return w
+}
+
+func TestSlackEventURLVerification(t *testing.T) {
+	h, _, _ := newEventTest(t)
+	w := serveEvent(t, h, eventPost("shh", `{"type": "url_verification", "challenge": "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`))
+	if w.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("challenge = %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, eventPost("wrong", `{"type": "url_verification", "challenge": "x"}`))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature status = %d", w.Code)
+	}
+}
+
+func TestSlackEventMessage(t *testing.T) {
+	h, slack, _ := newEventTest(t)
+	serveEvent(t, h, eventPost("shh", `{"type": "event_callback", "event": {
+		"type": "message", "channel": "C1", "user": "U1", "ts": "1451901600.000100",
+		"text": "Is PROJ-1 done? Not PROJ-404 or ABC-1"}}`))
+
+	msgs := slack.Messages()
+	var reply SlackMessage
+	if len(msgs) != 1 || msgs[0].JSON(&reply) != nil {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if reply.Channel != "C1" || reply.ThreadTs != "1451901600.000100" || len(reply.Attachments) != 1 ||
+		!strings.Contains(reply.Attachments[0].Pretext, "PROJ-1") {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	// Bots, including ourselves, are never answered
+	serveEvent(t, h, eventPost("shh", `{"type": "event_callback", "event": {
+		"type": "message", "channel": "C1", "bot_id": "B1", "ts": "1451901600.000200",
+		"text": "PROJ-1"}}`))
+	if n := len(slack.Messages()); n != 1 {
+		t.Errorf("answered a bot, %d messages", n)
+	}
+}
+
+func TestSlackEventMessageLinks(t *testing.T) {
+	h, slack, jiraURL := newEventTest(t)
+	link := jiraURL + "/browse/PROJ-1"
+
+	// Links to issues are left to the link_shared unfurl
+	serveEvent(t, h, eventPost("shh", `{"type": "event_callback", "event": {
+		"type": "message", "channel": "C1", "user": "U1", "ts": "1451901600.000100",
+		"text": "See <`+link+`> and <`+link+`|PROJ-1>"}}`))
+	if n := len(slack.Messages()); n != 0 {
+		t.Errorf("replied to issue links, %d messages", n)
+	}
+
+	serveEvent(t, h, eventPost("shh", `{"type": "event_callback", "event": {
+		"type": "message", "channel": "C1", "user": "U1", "ts": "1451901600.000200",
+		"text": "<`+link+`> is PROJ-1"}}`))
+	if n := len(slack.Messages()); n != 1 {
+		t.Errorf("key mentioned beside its link, %d messages", n)
+	}
+
+	// Links are matched on the JIRA domain, not the Slack one
+	h.Config.JIRA = &JIRAConfig{Domain: "jira"}
+	if !h.issueURLPattern().MatchString("https://jira.atlassian.net/browse/PROJ-1") {
+		t.Errorf("pattern %s ignores the JIRA domain", h.issueURLPattern())
+	}
+}
+
+func TestSlackEventLinkShared(t *testing.T) {
+	h, slack, jiraURL := newEventTest(t)
+	link := jiraURL + "/browse/PROJ-1"
+	serveEvent(t, h, eventPost("shh", `{"type": "event_callback", "event": {
+		"type": "link_shared", "channel": "C1", "message_ts": "1451901600.000100",
+		"links": [{"domain": "example.com", "url": "`+link+`"},
+			{"domain": "example.com", "url": "https://example.com/other"}]}}`))
+
+	reqs := slack.Requests()
+	var unfurl struct {
+		Channel string                `json:"channel"`
+		Ts      string                `json:"ts"`
+		Unfurls map[string]Attachment `json:"unfurls"`
+	}
+	if len(reqs) != 1 || reqs[0].Path != "/api/chat.unfurl" || reqs[0].JSON(&unfurl) != nil {
+		t.Fatalf("requests = %+v", reqs)
+	}
+	if unfurl.Channel != "C1" || unfurl.Ts != "1451901600.000100" || len(unfurl.Unfurls) != 1 {
+		t.Errorf("unfurl = %+v", unfurl)
+	}
+	if _, ok := unfurl.Unfurls[link]; !ok {
+		t.Errorf("%s not unfurled: %+v", link, unfurl.Unfurls)
+	}
+}
+
+func TestSlackEventAck(t *testing.T) {
+	h, slack, _ := newEventTest(t)
+	message := `{"type": "event_callback", "event": {
+		"type": "message", "channel": "C1", "ts": "1451901600.000100", "text": "PROJ-1"}}`
+
+	// Failures are not reported to Slack, which would retry them
+	slack.InjectFault(jirachattest.Fault{Status: http.StatusInternalServerError})
+	serveEvent(t, h, eventPost("shh", message))
+
+	r := eventPost("shh", message)
+	r.Header.Set("X-Slack-Retry-Num", "1")
+	r.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+	serveEvent(t, h, r)
+	if n := len(slack.Requests()); n != 1 {
+		t.Errorf("retry answered, %d requests", n)
+	}
+
+	// Misconfigured handlers refuse to serve rather than panic
+	h.Config.JIRA = nil
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, eventPost("shh", message))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status without JIRA = %d", w.Code)
+	}
+}
@@ -3,12 +3,15 @@ package jirachat
 import (
 	"errors"
 	"fmt"
-	"strconv"
+	"strings"
 )
 
 const (
 	issueLinkBase = "https://%s.atlassian.net/browse/%s"
 	userLinkBase  = "https://%s.atlassian.net/secure/ViewProfile.jspa?name=%s"
+
+	// Profiles of JIRA Cloud users, by account id
+	peopleLinkBase = "https://%s.atlassian.net/jira/people/%s"
 )
 
 var ErrSlackParse = errors.New("unknown Event Failed Slack Parsing")
@@ -24,6 +27,10 @@ type SlackMessage struct {
 	Icon_url     string       `json:"icon_url"`
 	Unfurl_links bool         `json:"unfurl_links"`
 	Attachments  []Attachment `json:"attachments"`
+
+	// Thread reply options, only honored by the Web API
+	ThreadTs       string `json:"thread_ts,omitempty"`
+	ReplyBroadcast bool   `json:"reply_broadcast,omitempty"`
 }
 
 // Attachment is an attachment to Payload.
@@ -50,6 +57,22 @@ type Attachment struct {
 
 	// Fields are displayed in a table on the message
 	Fields []Field `json:"fields"`
+
+	// Names of the attachment fields which are formatted with markdown,
+	// e.g. "pretext", "text", "fields"
+	// Optional
+	MrkdwnIn []string `json:"mrkdwn_in,omitempty"`
+
+	// Buttons shown below the attachment and the id sent back to your
+	// app when one is clicked
+	// Optional
+	CallbackId string   `json:"callback_id,omitempty"`
+	Actions    []Action `json:"actions,omitempty"`
+
+	// Unix time shown in the attachment footer in each reader's own
+	// time zone
+	// Optional
+	Ts int64 `json:"ts,omitempty"`
 }
 
 // Field is a field to Attachment.
@@ -73,9 +96,11 @@ type Field struct {
 // Default constructSlackMessage for issue_updated type. Unfortunately this includes
 // everything that isn't worklog or ticket create/delete
 func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
+	s.enrich(event)
 
 	payload := SlackMessage{}
 	var fields []Field
+	var pings []string
 	title := ""
 	user := event.GetUserLink(s.Config)
 	// Try to determine what kind of event this was
@@ -83,6 +108,8 @@ func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
 	case len(event.Comment.Id) > 0:
 		title = fmt.Sprintf("%s commented on %s", user,
 			event.GetIssueLink(s.Config))
+		var body string
+		body, pings = s.mentionComment(event.Comment.Body)
 		fields = []Field{
 			{
 				Title: "Issue",
@@ -91,7 +118,7 @@ func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
 			},
 			{
 				Title: "Comment",
-				Value: event.Comment.Body,
+				Value: body,
 				Short: false,
 			},
 		}
@@ -123,6 +150,11 @@ func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
 			to := "unassigned"
 			if len(event.Changelog.Items[0].ToString) > 0 {
 				to = event.Changelog.Items[0].ToString
+				// The issue in the payload already has the new assignee
+				if id := event.assigneeId(s.Config); len(id) > 0 {
+					to = "<@" + id + ">"
+					pings = []string{id}
+				}
 			}
 			fields = []Field{
 				{
@@ -136,6 +168,11 @@ func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
 					Short: false,
 				},
 			}
+		case s.Config.inPlace():
+			// The living message shows the change in its changelog
+			title = fmt.Sprintf("%s changed %s of %s", user,
+				strings.Join(event.changedFields(), ", "),
+				event.GetIssueLink(s.Config))
 		default:
 			// Post a generic event and post the details to the error channel
 			title = fmt.Sprintf("%s modified %s", event.User.DisplayName,
@@ -145,6 +182,8 @@ func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
 			return ErrSlackParse
 
 		}
+	case s.Config.inPlace():
+		title = fmt.Sprintf("%s modified %s", user, event.GetIssueLink(s.Config))
 	default:
 		// Post a generic event and post the details to the error channel
 		title = fmt.Sprintf("%s modified %s", event.User.DisplayName,
@@ -157,22 +196,45 @@ func (s *SlackService) IssueUpdated(event *JIRAWebevent) error {
 	attachment := Attachment{
 		Fallback: title,
 		Pretext:  title,
-		Color:    event.GetPriorityColor(),
+		Color:    event.GetColor(s.Config),
 		Fields:   fields,
+		MrkdwnIn: []string{"fields"},
 	}
+	s.Config.addIssueActions(&attachment, event.Issue.Key)
 
 	payload.Channel = s.Config.Channel
 	payload.Username = s.Config.BotName
 	payload.Icon_url = event.User.LargeAvatar()
 	payload.Unfurl_links = true
-	payload.Text = ""
+	payload.Text = pingText(pings)
 	payload.Attachments = []Attachment{attachment}
-	return payload.SendEvent(s.Config)
+	return s.send(event, &payload, true)
 }
 
 // Default construct SlackMessage for issue_created type
 func (s *SlackService) IssueCreated(event *JIRAWebevent) error {
+	s.enrich(event)
 	payload := SlackMessage{}
+	title := fmt.Sprintf("%s created %s", event.GetUserLink(s.Config),
+		event.GetIssueLink(s.Config))
+	attachment := s.issueAttachment(event, title)
+	s.Config.addIssueActions(&attachment, event.Issue.Key)
+
+	payload.Channel = s.Config.Channel
+	payload.Username = s.Config.BotName
+	payload.Icon_url = event.User.LargeAvatar()
+	payload.Unfurl_links = true
+	payload.Text = ""
+	if id := event.assigneeId(s.Config); len(id) > 0 {
+		payload.Text = pingText([]string{id})
+	}
+	payload.Attachments = []Attachment{attachment}
+	return s.send(event, &payload, false)
+}
+
+// issueAttachment returns the attachment describing an issue as shown
+// when it is created
+func (s *SlackService) issueAttachment(event *JIRAWebevent, title string) Attachment {
 	fields := []Field{
 		{
 			Title: "Summary",
@@ -181,7 +243,7 @@ func (s *SlackService) IssueCreated(event *JIRAWebevent) error {
 		},
 		{
 			Title: "Assignee",
-			Value: event.Issue.Fields.Assignee.DisplayName,
+			Value: event.AssigneeMention(s.Config),
 			Short: true,
 		},
 		{
@@ -190,31 +252,25 @@ func (s *SlackService) IssueCreated(event *JIRAWebevent) error {
 			Short: true,
 		},
 	}
-	title := fmt.Sprintf("%s created %s", event.GetUserLink(s.Config),
-		event.GetIssueLink(s.Config))
-	attachment := Attachment{
+	fields = append(fields, s.Config.issueFields(&event.Issue.Fields)...)
+	return Attachment{
 		Fallback: title,
 		Pretext:  title,
-		Color:    event.GetPriorityColor(),
+		Color:    event.GetColor(s.Config),
 		Fields:   fields,
 	}
-
-	payload.Channel = s.Config.Channel
-	payload.Username = s.Config.BotName
-	payload.Icon_url = event.User.LargeAvatar()
-	payload.Unfurl_links = true
-	payload.Text = ""
-	payload.Attachments = []Attachment{attachment}
-	return payload.SendEvent(s.Config)
 }
 
 // Default construct SlackMessage for issue_deleted type
 func (s *SlackService) IssueDeleted(event *JIRAWebevent) error {
+	s.enrich(event)
 	payload := SlackMessage{}
 	body := "None"
-	last := event.Issue.Fields.Comment.Total
+	// Total counts every comment but only the first page of comments
+	// is embedded in the payload, if any
+	last := len(event.Issue.Fields.Comment.Comments)
 	if last > 0 {
-		body = event.Issue.Fields.Comment.Comments[last-1].Body
+		body = event.Issue.Fields.Comment.Comments[last-1].Body.Mrkdwn()
 	}
 
 	fields := []Field{
@@ -237,6 +293,7 @@ func (s *SlackService) IssueDeleted(event *JIRAWebevent) error {
 		Fallback: title,
 		Pretext:  title,
 		Fields:   fields,
+		MrkdwnIn: []string{"fields"},
 	}
 
 	payload.Channel = s.Config.Channel
@@ -245,68 +302,38 @@ func (s *SlackService) IssueDeleted(event *JIRAWebevent) error {
 	payload.Unfurl_links = true
 	payload.Text = ""
 	payload.Attachments = []Attachment{attachment}
-	return payload.SendEvent(s.Config)
+	return s.send(event, &payload, false)
 }
 
-// Default construct SlackMessage for issue_deleted type
+// Default construct SlackMessage for the legacy jira:worklog_updated type.
+// Events carrying a worklog are rendered by WorklogChanged.
 func (s *SlackService) WorklogUpdated(event *JIRAWebevent) error {
-	payload := SlackMessage{}
-
-	timestr := ""
-	for i := range event.Changelog.Items {
-		if event.Changelog.Items[i].Field == "timespent" {
-			timestr = event.Changelog.Items[i].ToString
-		}
-	}
-	if len(timestr) == 0 {
-		return errors.New("Unable to read timespent field")
-	}
-
-	time, err := strconv.Atoi(timestr)
-	if err != nil {
-		return errors.New(fmt.Sprintf("Invalid timespent field %s", timestr))
-	}
-	time /= 60
-
-	if time == 1 {
-		timestr = strconv.Itoa(time) + " minute"
-	} else {
-		timestr = strconv.Itoa(time) + " minutes"
-	}
-
-	fields := []Field{
-		{
-			Title: "Total Work",
-			Value: timestr,
-			Short: false,
-		},
+	if len(event.Worklog.Id) > 0 {
+		return s.WorklogChanged(event)
 	}
+	s.enrich(event)
+	sum := event.WorklogSummary()
 
 	title := fmt.Sprintf("%s updated work log %s", event.GetUserLink(s.Config),
 		event.GetIssueLink(s.Config))
-	attachment := Attachment{
-		Fallback: title,
-		Pretext:  title,
-		Color:    event.GetPriorityColor(),
-		Fields:   fields,
+	if sum.Logged > 0 {
+		title = fmt.Sprintf("%s logged %s on %s", event.GetUserLink(s.Config),
+			durationFormat(s.Config.Durations).Format(sum.Logged),
+			event.GetIssueLink(s.Config))
 	}
-
-	payload.Channel = s.Config.Channel
-	payload.Username = s.Config.BotName
-	payload.Icon_url = event.User.LargeAvatar()
-	payload.Unfurl_links = true
-	payload.Text = ""
-	payload.Attachments = []Attachment{attachment}
-	return payload.SendEvent(s.Config)
+	return s.notice(event, title, event.User.LargeAvatar(),
+		s.worklogFields(event, sum), true)
 }
 
-func(s *SlackService) CommentCreated(event *JIRAWebevent) error{
+func (s *SlackService) CommentCreated(event *JIRAWebevent) error {
+	s.enrich(event)
 	payload := SlackMessage{}
 	var fields []Field
 	title := ""
 	user := event.Comment.GetUserLink(s.Config)
 	title = fmt.Sprintf("%s commented on %s", user,
 		event.GetIssueLink(s.Config))
+	comment, pings := s.mentionComment(event.Comment.Body)
 	fields = []Field{
 		{
 			Title: "Issue",
@@ -315,24 +342,25 @@ func(s *SlackService) CommentCreated(event *JIRAWebevent) error{
 		},
 		{
 			Title: "Comment",
-			Value: event.Comment.Body,
+			Value: comment,
 			Short: false,
 		}}
 
 	attachment := Attachment{
 		Fallback: title,
 		Pretext:  title,
-		Color:    event.GetPriorityColor(),
+		Color:    event.GetColor(s.Config),
 		Fields:   fields,
+		MrkdwnIn: []string{"fields"},
 	}
 
 	payload.Channel = s.Config.Channel
 	payload.Username = s.Config.BotName
 	payload.Icon_url = event.Comment.Author.LargeAvatar()
 	payload.Unfurl_links = true
-	payload.Text = ""
+	payload.Text = pingText(pings)
 	payload.Attachments = []Attachment{attachment}
-	return payload.SendEvent(s.Config)
+	return s.send(event, &payload, true)
 }
 
 // Returns a markdown formatted issue link with the issue key
@@ -345,37 +373,17 @@ func (e *JIRAWebevent) GetIssueLink(s *SlackConfig) string {
 // Returns a markdown formatted user link with the user name
 // as the link text
 func (e *JIRAWebevent) GetUserLink(s *SlackConfig) string {
-	link := fmt.Sprintf(userLinkBase, s.Domain, e.User.Name)
-	return fmt.Sprintf("<%s|%s>", link, e.User.DisplayName)
+	return s.userLink(&e.User)
 }
 
 // Returns a markdown formatted user link with the user name
 // as the link text
 func (e *JIRAComment) GetUserLink(s *SlackConfig) string {
-	link := fmt.Sprintf(userLinkBase, s.Domain, e.Author.Name)
-	return fmt.Sprintf("<%s|%s>", link, e.Author.DisplayName)
+	return s.userLink(&e.Author)
 }
 
-// Convert priority id to hex color string
+// Convert priority id to hex color string using the default color scheme.
+// Use GetColor to honor the configured scheme.
 func (e *JIRAWebevent) GetPriorityColor() string {
-
-	id := e.Issue.Fields.Priority.Id
-	switch {
-	case id == "1": // Blocker
-		return "#990000"
-	case id == "2":
-		return "#cc0000" // Critical
-	case id == "3":
-		return "#ff0000"
-	case id == "6": // Normal
-		return "#339933"
-	case id == "4": // Minor
-		return "#006600"
-	case id == "5": // Trivial
-		return "#003300"
-	case id == "10000": // Holding
-		return "#000000"
-	default:
-		return "good"
-	}
+	return DefaultColorScheme.Color(e).Slack
 }
@@ -3,13 +3,15 @@ package jirachat
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 // Slacker is the interface implmented by types that can parse their
-// own webevents.
+// own webevents. See also EventSlacker and Dispatch.
 type Slacker interface {
 	IssueCreated(*JIRAWebevent) error
 	IssueDeleted(JIRAWebevent) error
@@ -37,40 +39,169 @@ type SlackConfig struct {
 	// JIRA domain name
 	Domain string
 
-	client_ http.Client
+	// Optional Slack bot token. When set, messages are posted with the
+	// Web API instead of the webhook so updates to an issue are threaded
+	// under the first message about it.
+	Token string
+
+	// Optional Slack Web API base URL, defaults to https://slack.com/api/
+	ApiUrl string
+
+	// Remembers the thread of each issue when Token is set. Defaults to
+	// a store in process memory, kept per config.
+	Threads ThreadStore
+
+	// Also post status changes to the channel when replying in a thread
+	BroadcastStatus bool
+
+	// Keep a single message per issue, edited on every event to show the
+	// current status, assignee and priority of the issue. Requires Token.
+	UpdateInPlace bool
+
+	// Add buttons to issue messages letting users assign the issue to
+	// themselves or move it through the Transitions. Requires a
+	// SlackActionHandler serving your app's interactivity URL.
+	Interactive bool
+
+	// Transition or status names offered as buttons, e.g. "In Progress"
+	Transitions []string
+
+	// Optional mapping from JIRA user names or emails to Slack member
+	// ids used to mention assignees and users mentioned in comments
+	Users UserMap
+
+	// Look up Slack members missing from Users by their JIRA email
+	// address. Requires Token with the users:read.email scope.
+	LookupUsers bool
+
+	// Optional scheme choosing message colors. Defaults to
+	// DefaultColorScheme.
+	Colors *ColorScheme
+
+	// Optional working hours per day and days per week used to format
+	// logged time. Defaults to DefaultDurationFormat.
+	Durations *DurationFormat
+
+	// Additional fields shown on new issues, by JIRA field id or custom
+	// field name, e.g. "reporter", "components", "fixVersions", "duedate"
+	// or "Story Points". See IssueFieldData.FieldText.
+	IssueFields []string
+
+	// Optional JIRA REST API access used to fill in whatever the webhook
+	// payloads are missing before rendering them
+	JIRA *JIRAConfig
+
+	// Optional writer receiving every message as JSON instead of it being
+	// sent to Slack, to preview rendering changes
+	DryRun io.Writer
+
+	// Optional HTTP client used for every request, e.g. one with a proxy,
+	// client certificates or tracing. Takes precedence over Transport.
+	Client *http.Client
+
+	// Optional transport used with a default client when Client is not
+	// set, e.g. URLFetchTransport on the legacy App Engine runtime. With
+	// neither set, as on App Engine's second generation runtimes, net/http's
+	// default transport is used.
+	Transport http.RoundTripper
+
+	client_  *http.Client
+	users_   *userCache
+	threads_ ThreadStore
+	dryRun_  *dryRunCounter
 }
 
 // SlackService handles HTTP communication with Slack Chat
 type SlackService struct {
 	Config *SlackConfig
+	jira   *JIRAClient
 }
 
+// Guards the state created lazily on SlackConfigs and shared by their
+// copies
+var slackConfigMu sync.Mutex
+
 // Create a new slack service with the given config. A Slack service
-// provides default JIRAWebEvent parser and notification functions.
+// provides default JIRAWebEvent parser and notification functions. The
+// service works on a copy of the config, so handlers can create one per
+// request from a config they share.
 func NewSlackService(r *http.Request, config *SlackConfig) *SlackService {
-	config.client_ = getHttpClient(r)
-	svc := &SlackService{Config: config}
+	slackConfigMu.Lock()
+	if config.users_ == nil {
+		config.users_ = newUserCache()
+	}
+	if config.threads_ == nil {
+		config.threads_ = NewMemoryThreadStore()
+	}
+	if config.dryRun_ == nil {
+		config.dryRun_ = &dryRunCounter{}
+	}
+	c := *config
+	slackConfigMu.Unlock()
+
+	c.client_ = newHttpClient(c.Client, c.Transport)
+	svc := &SlackService{Config: &c}
+	if c.JIRA != nil {
+		// Without a client events are rendered as received
+		svc.jira, _ = NewJIRAClient(r, c.JIRA)
+	}
 	return svc
 }
 
+// httpClient returns the client set by NewSlackService or, for configs
+// used without a service, the configured one
+func (c *SlackConfig) httpClient() *http.Client {
+	if c.client_ != nil {
+		return c.client_
+	}
+	return newHttpClient(c.Client, c.Transport)
+}
+
+// enrich fills in missing event data from the JIRA REST API when the
+// service has access to it. JIRA events can be touchy, failures are
+// reported to ErrChan but are not fatal and the event is rendered with
+// what it has.
+func (s *SlackService) enrich(event *JIRAWebevent) {
+	if s.jira == nil {
+		return
+	}
+	if err := s.jira.Enrich(event); err != nil && len(s.Config.ErrChan) > 0 {
+		s.SendErrorNotice(fmt.Sprintf("Could not fetch JIRA data for %s: %v",
+			event.WebhookEvent, err), s.Config)
+	}
+}
+
 // SendEvent sends SlackMessage which contains JIRA data to Slack.
 func (p *SlackMessage) SendEvent(config *SlackConfig) error {
+	if config.DryRun != nil {
+		return writeDryRun(config.DryRun, "slack webhook", p)
+	}
 	data, err := json.Marshal(p)
-	resp, err := config.client_.Post(config.WebhookUrl, "application/json",
+	resp, err := config.httpClient().Post(config.WebhookUrl, "application/json",
 		strings.NewReader(string(data)))
 	if err != nil {
 		SendErrorNotice(fmt.Sprintf("%v", err), config)
 		return err
 	}
 	defer resp.Body.Close()
-	_, err = ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
+	// A misconfigured webhook must not look like a delivered message
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Slack webhook failed with %s: %s", resp.Status,
+			strings.TrimSpace(string(body)))
+	}
 
 	return nil
 }
 
+// SendErrorNotice sends an error report to the config's ErrChan
+func (s *SlackService) SendErrorNotice(msg string, config *SlackConfig) {
+	SendErrorNotice(msg, config)
+}
+
 // ConstructSlackError constructs an error message sent to Slack.
 func SendErrorNotice(msg string, config *SlackConfig) {
 	fields := []Field{
@@ -94,7 +225,11 @@ func SendErrorNotice(msg string, config *SlackConfig) {
 	payload.Attachments = []Attachment{attachment}
 	payload.Text = ""
 
+	if config.DryRun != nil {
+		writeDryRun(config.DryRun, "slack error notice", &payload)
+		return
+	}
 	data, _ := json.Marshal(payload)
-	config.client_.Post(config.ErrChan, "application/json",
+	config.httpClient().Post(config.ErrChan, "application/json",
 		strings.NewReader(string(data)))
 }
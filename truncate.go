@@ -0,0 +1,214 @@
+package jirachat
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Length limits of the chat backends. Longer messages are rejected or
+// silently cut off, so the renderers truncate their content to fit.
+const (
+	// Slack attachment field values
+	MaxSlackFieldLength = 2000
+
+	// HipChat notification and private message bodies
+	MaxHipMessageLength = 10000
+
+	// HipChat card descriptions
+	MaxHipCardLength = 1000
+)
+
+// Labels of the link appended to truncated text
+const (
+	moreComment = "view full comment"
+	moreIssue   = "view full issue"
+)
+
+// TruncateMrkdwn shortens Slack mrkdwn to at most limit bytes. It cuts on
+// a word boundary outside of links, mentions and entities, closes an open
+// code block and appends a link to url labelled more.
+func TruncateMrkdwn(s string, limit int, url, more string) string {
+	if len(s) <= limit {
+		return s
+	}
+	suffix := "…"
+	if len(url) > 0 {
+		suffix = fmt.Sprintf("… <%s|%s>", url, more)
+	}
+	// Room for closing a code block and the line break before the suffix
+	const closeCode = "\n```"
+	cut := truncateAt(s, limit-len(closeCode)-len("\n")-len(suffix), "<>")
+	s = s[:cut]
+	if strings.Count(s, "```")%2 == 1 {
+		s += closeCode
+	}
+	return s + "\n" + suffix
+}
+
+// Tags that have no closing tag
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// TruncateHTML shortens HTML to at most limit bytes. It cuts on a word
+// boundary outside of tags and entities, closes every open tag and
+// appends a link to url labelled more.
+func TruncateHTML(s string, limit int, url, more string) string {
+	if len(s) <= limit {
+		return s
+	}
+	suffix := "…"
+	if len(url) > 0 {
+		suffix = fmt.Sprintf(`… <a href="%s">%s</a>`, url, more)
+	}
+
+	// Closing tags are not known until the cut is made, cut once to find
+	// them and again leaving room for them
+	closing := ""
+	for i := 0; i < 2; i++ {
+		cut := truncateAt(s, limit-len(suffix)-len(closing), "<>")
+		closing = closeTags(s[:cut])
+		if cut+len(closing)+len(suffix) <= limit {
+			return s[:cut] + closing + suffix
+		}
+	}
+	cut := truncateAt(s, limit-len(suffix)-len(closing), "<>")
+	return s[:cut] + closeTags(s[:cut]) + suffix
+}
+
+// TruncateText shortens plain text to at most limit bytes, cutting on a
+// word boundary and appending url labelled more.
+func TruncateText(s string, limit int, url, more string) string {
+	if len(s) <= limit {
+		return s
+	}
+	suffix := "…"
+	if len(url) > 0 {
+		suffix = fmt.Sprintf("… %s: %s", more, url)
+	}
+	cut := truncateAt(s, limit-len(suffix)-1, "")
+	return s[:cut] + "\n" + suffix
+}
+
+// truncateAt returns the index to cut s at so that it is at most limit
+// bytes. The cut is moved back to the last whitespace, unless that loses
+// more than half of the text, and never splits a rune, an entity or the
+// text between the open and close delimiters, e.g. <link|text>.
+func truncateAt(s string, limit int, delims string) int {
+	if limit <= 0 {
+		return 0
+	}
+	if limit >= len(s) {
+		return len(s)
+	}
+
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if space := strings.LastIndexAny(s[:cut], " \t\n"); space > cut/2 {
+		cut = space
+	}
+
+	if len(delims) == 2 {
+		open := strings.LastIndexByte(s[:cut], delims[0])
+		if open > strings.LastIndexByte(s[:cut], delims[1]) {
+			cut = open
+		}
+	}
+	if amp := strings.LastIndexByte(s[:cut], '&'); amp > strings.LastIndexByte(s[:cut], ';') {
+		cut = amp
+	}
+	return cut
+}
+
+// closeTags returns the closing tags of every tag left open in s
+func closeTags(s string) string {
+	var open []string
+	for {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			break
+		}
+		tag := s[start+1 : start+end]
+		s = s[start+end+1:]
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.Fields(strings.Trim(tag, "/") + " ")[0])
+		switch {
+		case voidTags[name] || strings.HasSuffix(tag, "/"):
+		case closing:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					open = open[:i]
+					break
+				}
+			}
+		default:
+			open = append(open, name)
+		}
+	}
+
+	var out strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return out.String()
+}
+
+// CommentURL returns the link to the event's comment, or to the issue for
+// events without a comment
+func (e *JIRAWebevent) CommentURL(domain string) string {
+	link := fmt.Sprintf(issueLinkBase, domain, e.Issue.Key)
+	if len(e.Comment.Id) == 0 {
+		return link
+	}
+	return fmt.Sprintf("%s?focusedCommentId=%s#comment-%s", link,
+		e.Comment.Id, e.Comment.Id)
+}
+
+// moreLink returns the link appended to truncated text about the event,
+// to its comment or its issue
+func (e *JIRAWebevent) moreLink(domain string) (url, more string) {
+	more = moreIssue
+	if len(e.Comment.Id) > 0 {
+		more = moreComment
+	}
+	return e.CommentURL(domain), more
+}
+
+// truncate shortens the payload's field values to Slack's limits, linking
+// the truncated text to the event's comment or issue
+func (p *SlackMessage) truncate(event *JIRAWebevent, domain string) {
+	url, more := event.moreLink(domain)
+	for i := range p.Attachments {
+		fields := p.Attachments[i].Fields
+		for j := range fields {
+			fields[j].Value = TruncateMrkdwn(fields[j].Value,
+				MaxSlackFieldLength, url, more)
+		}
+	}
+}
+
+// truncate shortens the message to HipChat's limit, linking the truncated
+// text to the event the message is about, if any
+func (n *NotificationRequest) truncate() {
+	if n.MessageFormat == FormatHTML {
+		n.Message = TruncateHTML(n.Message, MaxHipMessageLength, n.moreURL_, n.more_)
+	} else {
+		n.Message = TruncateText(n.Message, MaxHipMessageLength, n.moreURL_, n.more_)
+	}
+}
+
+// truncate shortens the message to HipChat's limit, linking the truncated
+// text to the event the message is about, if any
+func (m *MessageRequest) truncate() {
+	if m.MessageFormat == FormatHTML {
+		m.Message = TruncateHTML(m.Message, MaxHipMessageLength, m.moreURL_, m.more_)
+	} else {
+		m.Message = TruncateText(m.Message, MaxHipMessageLength, m.moreURL_, m.more_)
+	}
+}
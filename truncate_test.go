@@ -0,0 +1,57 @@
+package jirachat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateMrkdwn(t *testing.T) {
+	words := "Look at <https://example.com/very/long|this link> now\n```\n" +
+		strings.Repeat("code ", 100)
+	solid := "```\n" + strings.Repeat("x", 300)
+	tests := []struct {
+		name  string
+		s     string
+		limit int
+		url   string
+	}{
+		{"code block", words, 130, "https://x.atlassian.net/browse/A-1"},
+		{"code block without whitespace", solid, 100, "https://x.atlassian.net/browse/A-1"},
+		{"code block without whitespace or link", solid, 100, ""},
+	}
+	for _, tt := range tests {
+		got := TruncateMrkdwn(tt.s, tt.limit, tt.url, moreComment)
+		if len(got) > tt.limit {
+			t.Errorf("%s: len = %d, want at most %d", tt.name, len(got), tt.limit)
+		}
+		if strings.Count(got, "```") != 2 {
+			t.Errorf("%s: code block not closed: %q", tt.name, got)
+		}
+		if len(tt.url) > 0 && !strings.HasSuffix(got, "… <"+tt.url+"|view full comment>") {
+			t.Errorf("%s: missing link: %q", tt.name, got)
+		}
+	}
+
+	got := TruncateMrkdwn(words, 50, "", "")
+	if strings.Contains(got, "<https") {
+		t.Errorf("cut inside link: %q", got)
+	}
+}
+
+func TestTruncateHTML(t *testing.T) {
+	s := "<b>Status</b><br><ul><li>" + strings.Repeat("word ", 50) + "</li></ul>"
+	got := TruncateHTML(s, 100, "https://example.com", moreIssue)
+
+	if len(got) > 100 {
+		t.Errorf("len = %d, want at most 100", len(got))
+	}
+	if !strings.Contains(got, "</li></ul>…") {
+		t.Errorf("tags not closed: %q", got)
+	}
+}
+
+func TestTruncateShort(t *testing.T) {
+	if got := TruncateText("short", 10, "https://example.com", moreIssue); got != "short" {
+		t.Errorf("got %q, want unchanged", got)
+	}
+}
@@ -0,0 +1,167 @@
+package jirachat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// UserMap maps JIRA user names or email addresses to Slack member ids,
+// e.g. {"mmcfly": "U024BE7LH", "marty@example.com": "U024BE7LH"}. Email
+// addresses match whatever their case.
+type UserMap map[string]string
+
+// LoadUserMap reads a UserMap from a JSON file. Email addresses are
+// lower cased.
+func LoadUserMap(path string) (UserMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw UserMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Invalid user map %s: %v", path, err)
+	}
+	users := make(UserMap, len(raw))
+	for k, id := range raw {
+		if strings.Contains(k, "@") {
+			k = strings.ToLower(k)
+		}
+		users[k] = id
+	}
+	return users, nil
+}
+
+// email returns the member id mapped to the lower case email address
+func (m UserMap) email(email string) (string, bool) {
+	if id, ok := m[email]; ok {
+		return id, true
+	}
+	for k, id := range m {
+		if strings.EqualFold(k, email) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// userCache remembers Slack member ids looked up by email. It lives on the
+// SlackConfig so it survives across the per-request SlackService instances.
+type userCache struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newUserCache() *userCache {
+	return &userCache{ids: make(map[string]string)}
+}
+
+// SlackUserId returns the Slack member id of a JIRA user or an empty
+// string if the user is unknown. The static Users mapping is consulted
+// first, then Slack's users.lookupByEmail when LookupUsers is set.
+//
+// Slack API docs: https://api.slack.com/methods/users.lookupByEmail
+func (c *SlackConfig) SlackUserId(email, name string) string {
+	email = strings.ToLower(email)
+	if id, ok := c.Users[name]; ok && len(name) > 0 {
+		return id
+	}
+	if len(email) > 0 {
+		if id, ok := c.Users.email(email); ok {
+			return id
+		}
+	}
+	if !c.LookupUsers || len(email) == 0 || len(c.Token) == 0 {
+		return ""
+	}
+
+	cache := c.users_
+	if cache == nil {
+		cache = newUserCache()
+	}
+	cache.mu.Lock()
+	id, ok := cache.ids[email]
+	cache.mu.Unlock()
+	if ok {
+		return id
+	}
+
+	var result struct {
+		User struct {
+			Id string `json:"id"`
+		} `json:"user"`
+	}
+	if _, err := c.apiCall("users.lookupByEmail",
+		url.Values{"email": {email}}, &result); err != nil {
+		// users_not_found is cached too, the user simply has no
+		// Slack account
+		var serr *SlackError
+		if !errors.As(err, &serr) || serr.Code != "users_not_found" {
+			return ""
+		}
+	}
+
+	cache.mu.Lock()
+	cache.ids[email] = result.User.Id
+	cache.mu.Unlock()
+	return result.User.Id
+}
+
+// mention returns a Slack mention of the user, falling back to the
+// display name for users without a Slack member id
+func (c *SlackConfig) mention(email, name, displayName string) string {
+	if id := c.SlackUserId(email, name); len(id) > 0 {
+		return "<@" + id + ">"
+	}
+	return displayName
+}
+
+// AssigneeMention returns a Slack mention of the issue's assignee or
+// their display name
+func (e *JIRAWebevent) AssigneeMention(s *SlackConfig) string {
+	a := e.Issue.Fields.Assignee
+	return s.mention(a.Email, a.Name, a.DisplayName)
+}
+
+// assigneeId returns the Slack member id of the issue's assignee, if any
+func (e *JIRAWebevent) assigneeId(s *SlackConfig) string {
+	a := e.Issue.Fields.Assignee
+	if len(a.Name) == 0 && len(a.Email) == 0 {
+		return ""
+	}
+	return s.SlackUserId(a.Email, a.Name)
+}
+
+// mentionComment converts a comment body to mrkdwn, replacing the JIRA
+// user mentions with Slack mentions. The mentioned Slack ids are returned
+// so the message can ping them.
+func (s *SlackService) mentionComment(body JIRAText) (string, []string) {
+	var ids []string
+	conv := &MarkupConverter{Mention: func(name, display string) string {
+		email := ""
+		if s.jira != nil {
+			if user, err := s.jira.GetUser(name); err == nil {
+				email = user.EmailAddress
+			}
+		}
+		if id := s.Config.SlackUserId(email, name); len(id) > 0 {
+			ids = append(ids, id)
+			return "<@" + id + ">"
+		}
+		return ""
+	}}
+	return conv.Mrkdwn(string(body)), ids
+}
+
+// pingText returns the message text notifying the Slack users
+func pingText(ids []string) string {
+	mentions := make([]string, 0, len(ids))
+	for _, id := range ids {
+		mentions = append(mentions, "<@"+id+">")
+	}
+	return strings.Join(mentions, " ")
+}
@@ -0,0 +1,81 @@
+package jirachat
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+func TestSlackUserId(t *testing.T) {
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	slack.Users["marty@example.com"] = "U024BE7LH"
+
+	config := &SlackConfig{
+		ApiUrl:      slack.ApiURL(),
+		Token:       "xoxb-test",
+		LookupUsers: true,
+		Users: UserMap{
+			"dbrown":           "U0G9QF9C6",
+			"Biff@Example.com": "U0BIFF",
+		},
+	}
+	svc := NewSlackService(nil, config)
+
+	tests := []struct {
+		email, name, want string
+	}{
+		{"", "dbrown", "U0G9QF9C6"},
+		{"biff@example.com", "", "U0BIFF"},
+		{"Marty@Example.com", "mmcfly", "U024BE7LH"},
+		{"marty@example.com", "", "U024BE7LH"},
+		{"jennifer@example.com", "", ""},
+		{"jennifer@example.com", "", ""},
+		{"", "nobody", ""},
+	}
+	for _, tt := range tests {
+		if got := svc.Config.SlackUserId(tt.email, tt.name); got != tt.want {
+			t.Errorf("SlackUserId(%q, %q) = %q, want %q", tt.email, tt.name, got, tt.want)
+		}
+	}
+
+	// Found and missing users are both looked up once
+	if n := len(slack.Requests()); n != 2 {
+		t.Errorf("looked up users %d times, want 2", n)
+	}
+
+	// Other errors are not cached
+	svc.Config.Token = "wrong"
+	svc.Config.users_ = newUserCache()
+	for i := 0; i < 2; i++ {
+		if got := svc.Config.SlackUserId("doc@example.com", ""); got != "" {
+			t.Errorf("SlackUserId with a bad token = %q", got)
+		}
+	}
+	if n := len(slack.Requests()); n != 4 {
+		t.Errorf("looked up users %d times, want 4", n)
+	}
+}
+
+func TestLoadUserMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := ioutil.WriteFile(path, []byte(`{"MMcFly": "U1", "Marty@Example.com": "U2"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := LoadUserMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users["MMcFly"] != "U1" || users["marty@example.com"] != "U2" {
+		t.Errorf("users = %v", users)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`["U1"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUserMap(path); err == nil {
+		t.Error("invalid map loaded")
+	}
+}
@@ -0,0 +1,225 @@
+package jirachat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DurationFormat formats durations the way JIRA does, e.g. 1w 2d 3h 15m.
+// Days and weeks are working days and weeks as configured in JIRA's time
+// tracking settings.
+type DurationFormat struct {
+	HoursPerDay int
+	DaysPerWeek int
+}
+
+// DefaultDurationFormat matches JIRA's default time tracking settings
+var DefaultDurationFormat = &DurationFormat{HoursPerDay: 8, DaysPerWeek: 5}
+
+// durationFormat returns f or the default format when f is nil
+func durationFormat(f *DurationFormat) *DurationFormat {
+	if f == nil {
+		return DefaultDurationFormat
+	}
+	return f
+}
+
+// Format returns the duration in seconds as weeks, days, hours and
+// minutes, e.g. 1w 2d 3h 15m. Units that are zero are left out.
+func (f *DurationFormat) Format(seconds int) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+
+	minutes := seconds / 60
+	units := []struct {
+		minutes int
+		suffix  string
+	}{
+		{f.HoursPerDay * f.DaysPerWeek * 60, "w"},
+		{f.HoursPerDay * 60, "d"},
+		{60, "h"},
+		{1, "m"},
+	}
+
+	var parts []string
+	for _, unit := range units {
+		if unit.minutes <= 0 {
+			continue
+		}
+		if n := minutes / unit.minutes; n > 0 {
+			parts = append(parts, strconv.Itoa(n)+unit.suffix)
+			minutes -= n * unit.minutes
+		}
+	}
+	if len(parts) == 0 {
+		return "0m"
+	}
+	return sign + strings.Join(parts, " ")
+}
+
+// FormatDuration formats seconds with DefaultDurationFormat
+func FormatDuration(seconds int) string {
+	return DefaultDurationFormat.Format(seconds)
+}
+
+// WorklogSummary describes the work logged by a worklog event along with
+// the time tracking of its issue. Durations are in seconds.
+type WorklogSummary struct {
+	Author  JIRAUser
+	Started JIRATime
+	Comment JIRAText
+
+	// Time logged by the event, negative when a work log was deleted
+	Logged int
+
+	// Whether the event deleted a work log
+	Deleted bool
+
+	// Time logged on the issue in total
+	Spent int
+
+	// Original and remaining estimates of the issue, zero if none
+	Estimate  int
+	Remaining int
+
+	// Change of the remaining estimate made by the event, only known
+	// for the legacy jira:worklog_updated event
+	RemainingDelta int
+}
+
+// WorklogSummary collects the work logged by the event, from the worklog
+// of worklog_* events or from the changelog of jira:worklog_updated events
+func (e *JIRAWebevent) WorklogSummary() *WorklogSummary {
+	fields := &e.Issue.Fields
+	sum := &WorklogSummary{
+		Author:    e.Worklog.Author,
+		Started:   e.Worklog.Started,
+		Comment:   e.Worklog.Comment,
+		Logged:    e.Worklog.TimeSpentSeconds,
+		Spent:     firstNonZero(fields.TimeSpent, fields.TimeTracking.TimeSpentSeconds),
+		Estimate:  firstNonZero(fields.TimeOriginalEstimate, fields.TimeTracking.OriginalEstimateSeconds),
+		Remaining: firstNonZero(fields.TimeEstimate, fields.TimeTracking.RemainingEstimateSeconds),
+	}
+	if e.WebhookEvent == EventWorklogDeleted {
+		sum.Logged = -sum.Logged
+		sum.Deleted = true
+	}
+	if len(sum.Author.DisplayName) == 0 {
+		sum.Author = e.User
+	}
+
+	for _, item := range e.Changelog.Items {
+		from, _ := strconv.Atoi(item.From)
+		to, _ := strconv.Atoi(item.To)
+		switch item.Field {
+		case "timespent":
+			sum.Spent = to
+			if sum.Logged == 0 {
+				sum.Logged = to - from
+			}
+		case "timeestimate":
+			sum.Remaining = to
+			sum.RemainingDelta = to - from
+		case "timeoriginalestimate":
+			sum.Estimate = to
+		}
+	}
+	return sum
+}
+
+func firstNonZero(values ...int) int {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// LoggedText formats the time logged by the event. A deleted work log is
+// described by the time it had logged, e.g. "3h" rather than "-3h".
+func (w *WorklogSummary) LoggedText(f *DurationFormat) string {
+	if w.Deleted {
+		return f.Format(-w.Logged)
+	}
+	return f.Format(w.Logged)
+}
+
+// Progress describes the total time logged against the estimate, e.g.
+// "5h of 2d estimated"
+func (w *WorklogSummary) Progress(f *DurationFormat) string {
+	if w.Spent == 0 {
+		return ""
+	}
+	if w.Estimate == 0 {
+		return f.Format(w.Spent)
+	}
+	return fmt.Sprintf("%s of %s estimated", f.Format(w.Spent), f.Format(w.Estimate))
+}
+
+// RemainingText describes the remaining estimate and its change, e.g.
+// "1d 3h (-1h 30m)"
+func (w *WorklogSummary) RemainingText(f *DurationFormat) string {
+	if w.Remaining == 0 && w.RemainingDelta == 0 {
+		return ""
+	}
+	text := f.Format(w.Remaining)
+	if w.RemainingDelta > 0 {
+		text += fmt.Sprintf(" (+%s)", f.Format(w.RemainingDelta))
+	} else if w.RemainingDelta < 0 {
+		text += fmt.Sprintf(" (%s)", f.Format(w.RemainingDelta))
+	}
+	return text
+}
+
+// worklogFields returns the Slack fields describing the work logged
+func (s *SlackService) worklogFields(event *JIRAWebevent, sum *WorklogSummary) []Field {
+	f := durationFormat(s.Config.Durations)
+	var fields []Field
+	if summary := event.Issue.Fields.Summary; len(summary) > 0 {
+		fields = append(fields, Field{
+			Title: "Issue",
+			Value: summary,
+			Short: false,
+		})
+	}
+	if sum.Logged != 0 {
+		fields = append(fields, Field{
+			Title: "Time Spent",
+			Value: sum.LoggedText(f),
+			Short: true,
+		})
+	}
+	if !sum.Started.IsZero() {
+		fields = append(fields, Field{
+			Title: "Started",
+			Value: sum.Started.SlackDate(SlackDateFormat),
+			Short: true,
+		})
+	}
+	if progress := sum.Progress(f); len(progress) > 0 {
+		fields = append(fields, Field{
+			Title: "Logged",
+			Value: progress,
+			Short: true,
+		})
+	}
+	if remaining := sum.RemainingText(f); len(remaining) > 0 {
+		fields = append(fields, Field{
+			Title: "Remaining",
+			Value: remaining,
+			Short: true,
+		})
+	}
+	if len(sum.Comment) > 0 {
+		fields = append(fields, Field{
+			Title: "Comment",
+			Value: sum.Comment.Mrkdwn(),
+			Short: false,
+		})
+	}
+	return fields
+}
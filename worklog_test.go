@@ -0,0 +1,103 @@
+package jirachat
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/corytodd/jirachat/jirachattest"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		seconds int
+		format  *DurationFormat
+		want    string
+	}{
+		{0, DefaultDurationFormat, "0m"},
+		{90 * 60, DefaultDurationFormat, "1h 30m"},
+		{(5*8*60 + 2*8*60 + 3*60 + 15) * 60, DefaultDurationFormat, "1w 2d 3h 15m"},
+		{-2 * 60 * 60, DefaultDurationFormat, "-2h"},
+		{(24 + 3) * 60 * 60, &DurationFormat{HoursPerDay: 24, DaysPerWeek: 7}, "1d 3h"},
+	}
+	for _, tt := range tests {
+		if got := tt.format.Format(tt.seconds); got != tt.want {
+			t.Errorf("Format(%d) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestWorklogSummary(t *testing.T) {
+	event := &JIRAWebevent{
+		WebhookEvent: EventLegacyWorklogUpdated,
+		Changelog: JIRAChangelog{Items: []ChangleLogItems{
+			{Field: "timespent", From: "3600", To: "18000"},
+			{Field: "timeestimate", From: "36000", To: "25200"},
+		}},
+	}
+	event.Issue.Fields.TimeOriginalEstimate = 57600
+
+	sum := event.WorklogSummary()
+	f := DefaultDurationFormat
+	if got := f.Format(sum.Logged); got != "4h" {
+		t.Errorf("logged = %q", got)
+	}
+	if got := sum.Progress(f); got != "5h of 2d estimated" {
+		t.Errorf("progress = %q", got)
+	}
+	if got := sum.RemainingText(f); got != "7h (-3h)" {
+		t.Errorf("remaining = %q", got)
+	}
+}
+
+func TestWorklogSlack(t *testing.T) {
+	tests := []struct {
+		file    string
+		pretext string
+		fields  map[string]string
+	}{
+		{
+			"cloud/worklog_created.json",
+			"<https://example.atlassian.net/jira/people/557058:0f6b6c1e-2c1f-4f8b-9d7e-000000000001|Marty McFly> logged 3h on issue 10042",
+			map[string]string{"Time Spent": "3h", "Started": "<!date^1451890800^{date_short_pretty} at {time}|Mon Jan 4, 07:00 UTC>"},
+		},
+		{
+			"cloud/worklog_deleted.json",
+			"A work log of 3h by <https://example.atlassian.net/jira/people/557058:0f6b6c1e-2c1f-4f8b-9d7e-000000000001|Marty McFly> was deleted from issue 10042",
+			map[string]string{"Time Spent": "3h"},
+		},
+		{
+			"server/worklog_updated_legacy.json",
+			"<https://example.atlassian.net/secure/ViewProfile.jspa?name=mmcfly|Marty McFly> logged 3h on <https://example.atlassian.net/browse/PROJ-42|PROJ-42>",
+			map[string]string{"Issue": "Flux capacitor drains the battery at 88 mph", "Time Spent": "3h", "Remaining": "5h (-3h)"},
+		},
+	}
+	slack := jirachattest.NewSlackServer("xoxb-test")
+	defer slack.Close()
+	for _, tt := range tests {
+		payload, err := ioutil.ReadFile(webhookCorpus + "/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := parseString(t, string(payload))
+		svc := newSlackTest(slack, &SlackConfig{Channel: "C1"})
+		if err := svc.Dispatch(&event); err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		attachment := lastMessage(t, slack).Attachments[0]
+		if attachment.Pretext != tt.pretext {
+			t.Errorf("%s: pretext = %q, want %q", tt.file, attachment.Pretext, tt.pretext)
+		}
+		got := map[string]string{}
+		for _, field := range attachment.Fields {
+			got[field.Title] = field.Value
+		}
+		if summary, ok := got["Issue"]; ok && summary == "" {
+			t.Errorf("%s: empty Issue field", tt.file)
+		}
+		for title, want := range tt.fields {
+			if got[title] != want {
+				t.Errorf("%s: %s = %q, want %q", tt.file, title, got[title], want)
+			}
+		}
+	}
+}